@@ -4,8 +4,15 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/SantiagoBedoya/otp-api/internal/breached"
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/mailer"
+	"github.com/SantiagoBedoya/otp-api/internal/middleware"
+	"github.com/SantiagoBedoya/otp-api/internal/passhash"
 	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
 	"github.com/SantiagoBedoya/otp-api/internal/route"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/SantiagoBedoya/otp-api/internal/sms"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -15,6 +22,70 @@ func main() {
 		log.Fatalf("Error loading environment variables: %v", err)
 	}
 	router := gin.Default()
+	if err := router.SetTrustedProxies(config.LoadServer().TrustedProxies); err != nil {
+		log.Fatalf("Error configuring trusted proxies: %v", err)
+	}
+
+	keyring, err := config.LoadSecretKeyring()
+	if err != nil {
+		log.Fatalf("Error loading encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Println("SECRET_ENCRYPTION_KEYS is not set, 2FA secrets are stored in plain text")
+	}
+
+	keys, err := config.LoadSigningKeys()
+	if err != nil {
+		log.Fatalf("Error loading signing keys: %v", err)
+	}
+
+	mail, err := mailer.New(config.LoadMail())
+	if err != nil {
+		log.Fatalf("Error configuring the mailer: %v", err)
+	}
+
+	smsCfg := config.LoadSMS()
+	smsSender, err := sms.New(smsCfg)
+	if err != nil {
+		log.Fatalf("Error configuring the SMS sender: %v", err)
+	}
+	if smsCfg.Driver == "fake" {
+		log.Println("SMS_DRIVER is fake, text messages are only logged")
+	}
+
+	resetCfg, err := config.LoadPasswordReset()
+	if err != nil {
+		log.Fatalf("Error configuring password resets: %v", err)
+	}
+
+	verifyCfg, err := config.LoadEmailVerification()
+	if err != nil {
+		log.Fatalf("Error configuring email verification: %v", err)
+	}
+
+	hashCfg, err := config.LoadPasswordHash()
+	if err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+	}
+	passwordPolicy, err := config.LoadPasswordPolicy(hashCfg)
+	if err != nil {
+		log.Fatalf("Error configuring the password policy: %v", err)
+	}
+	var breachedPasswords service.BreachedPasswords
+	if passwordPolicy.BreachedDir == "" {
+		log.Println("BREACHED_PASSWORDS_DIR is not set, passwords are not screened against breaches")
+	} else {
+		list, err := breached.Open(passwordPolicy.BreachedDir)
+		if err != nil {
+			log.Fatalf("Error opening the breached password list: %v", err)
+		}
+		breachedPasswords = list
+	}
+
+	hasher, err := passhash.New(hashCfg)
+	if err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+	}
 
 	db, err := mysql.NewMySQLConn()
 	if err != nil {
@@ -27,8 +98,14 @@ func main() {
 		})
 	})
 
-	route.InitializeUserRoutes(router, db)
-	route.InitializeAuthRoutes(router, db)
+	revocations := service.NewRevocationService(mysql.NewRevocationRepository(db))
+	auth := middleware.NewAuth(revocations, keys)
+
+	authService := route.InitializeAuthRoutes(router, db, keyring, auth, revocations, keys, mail, smsSender, resetCfg, verifyCfg, passwordPolicy, breachedPasswords, hasher)
+	route.InitializeUserRoutes(router, db, auth, authService)
+	route.InitializeWebAuthnRoutes(router, db, auth, authService)
+	route.InitializeOIDCRoutes(router, db, auth, authService, keys)
+	route.InitializeWellKnownRoutes(router, keys)
 
 	if err := router.Run(":8080"); err != nil {
 		panic(err)
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	name := flag.String("name", "", "name of the application")
+	redirectURIs := flag.String("redirect-uris", "", "comma separated list of allowed redirect URIs, empty for resource servers")
+	public := flag.Bool("public", false, "register a public client without secret, PKCE only")
+	flag.Parse()
+	if *name == "" {
+		flag.Usage()
+		log.Fatal("name is required")
+	}
+	var uris []string
+	if *redirectURIs != "" {
+		uris = strings.Split(*redirectURIs, ",")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error loading environment variables: %v", err)
+	}
+	db, err := mysql.NewMySQLConn()
+	if err != nil {
+		log.Fatalf("Error connecting to MySQL: %+v", err)
+	}
+	defer db.Close()
+
+	clients := service.NewClientService(mysql.NewOAuthClientRepository(db))
+	client, secret, err := clients.Register(*name, uris, *public)
+	if err != nil {
+		log.Fatalf("Error registering client: %v", err)
+	}
+	fmt.Printf("client_id: %s\n", client.ID)
+	if secret != "" {
+		fmt.Printf("client_secret: %s\n", secret)
+	}
+}
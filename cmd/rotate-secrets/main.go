@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error loading environment variables: %v", err)
+	}
+	keyring, err := config.LoadSecretKeyring()
+	if err != nil {
+		log.Fatalf("Error loading encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Fatal("SECRET_ENCRYPTION_KEYS is not set")
+	}
+
+	db, err := mysql.NewMySQLConn()
+	if err != nil {
+		log.Fatalf("Error connecting to MySQL: %+v", err)
+	}
+	defer db.Close()
+
+	updated, err := mysql.ReencryptSecrets(db, keyring)
+	if err != nil {
+		log.Fatalf("Error re-encrypting secrets after %d rows: %v", updated, err)
+	}
+	log.Printf("Re-encrypted %d rows with key %s", updated, keyring.CurrentKeyID())
+}
@@ -0,0 +1,60 @@
+// Package breached looks passwords up in a local copy of a breached
+// password list. The list is split in SHA-1 prefix buckets, the layout of
+// the Have I Been Pwned range API: the file <PREFIX>.txt holds the hashes
+// starting with that 5 character hex prefix, one per line as the remaining
+// 35 characters optionally followed by ":<count>".
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixLength = 5
+
+type List struct {
+	dir string
+}
+
+// Open uses the buckets in dir. Missing buckets are treated as empty, so a
+// partial copy of the list only screens the prefixes it has.
+func Open(dir string) (*List, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password list %s is not a directory", dir)
+	}
+	return &List{dir: dir}, nil
+}
+
+// Contains tells whether the SHA-1 hash of password is in its bucket.
+func (l *List) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	f, err := os.Open(filepath.Join(l.dir, hash[:prefixLength]+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	suffix := hash[prefixLength:]
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
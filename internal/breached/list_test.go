@@ -0,0 +1,44 @@
+package breached_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SantiagoBedoya/otp-api/internal/breached"
+)
+
+func TestListContains(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "123456" is 7C4A8D09CA3762AF61E59520943DC26494F8941B.
+	bucket := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" +
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8:37359195\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "7C4A8.txt"), []byte("D09CA3762AF61E59520943DC26494F8941B:37359195\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(bucket), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := breached.Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for password, want := range map[string]bool{
+		"123456":                       true,
+		"password":                     true,
+		"correct horse battery staple": false,
+	} {
+		got, err := list.Contains(password)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != want {
+			t.Errorf("Contains(%q) = %t, want %t", password, got, want)
+		}
+	}
+
+	if _, err := breached.Open(filepath.Join(dir, "7C4A8.txt")); err == nil {
+		t.Error("a file should not be accepted as the list")
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func getString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value for %s, using %d: %v", key, fallback, err)
+		return fallback
+	}
+	return n
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid value for %s, using %s: %v", key, fallback, err)
+		return fallback
+	}
+	return d
+}
+
+func getBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value for %s, using %t: %v", key, fallback, err)
+		return fallback
+	}
+	return b
+}
+
+// getList splits a comma separated value into its non-empty items.
+func getList(key string, fallback []string) []string {
+	value := getString(key, "")
+	if value == "" {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
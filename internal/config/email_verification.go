@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Email verification policies, from the most to the least permissive.
+// EmailVerificationSignIn also blocks enrollment, as unverified users
+// cannot sign in to enroll.
+const (
+	EmailVerificationNone       = "none"
+	EmailVerificationEnrollment = "enrollment"
+	EmailVerificationSignIn     = "sign_in"
+)
+
+type EmailVerification struct {
+	// Policy is what unverified users cannot do, see the constants above.
+	Policy string
+	TTL    time.Duration
+	// ResendInterval is the minimum time between two verification emails
+	// for a user.
+	ResendInterval time.Duration
+	// URL is the page that confirms the address, the verification token is
+	// added as the token query parameter. ChangeURL is the same for the
+	// new address of a user changing their email.
+	URL       string
+	ChangeURL string
+}
+
+func DefaultEmailVerification() EmailVerification {
+	return EmailVerification{
+		Policy:         EmailVerificationEnrollment,
+		TTL:            time.Hour * 24,
+		ResendInterval: time.Minute,
+		URL:            "http://localhost:3000/verify-email",
+		ChangeURL:      "http://localhost:3000/confirm-email",
+	}
+}
+
+// LoadEmailVerification falls back to the default policy when it is
+// unknown, but rejects a TTL that would issue expired links and a negative
+// ResendInterval, which would turn off the throttling.
+func LoadEmailVerification() (EmailVerification, error) {
+	cfg := DefaultEmailVerification()
+	loaded := EmailVerification{
+		Policy:         getString("EMAIL_VERIFICATION_POLICY", cfg.Policy),
+		TTL:            getDuration("EMAIL_VERIFICATION_TTL", cfg.TTL),
+		ResendInterval: getDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", cfg.ResendInterval),
+		URL:            getString("EMAIL_VERIFICATION_URL", cfg.URL),
+		ChangeURL:      getString("EMAIL_CHANGE_URL", cfg.ChangeURL),
+	}
+	switch loaded.Policy {
+	case EmailVerificationNone, EmailVerificationEnrollment, EmailVerificationSignIn:
+	default:
+		log.Printf("Invalid value for EMAIL_VERIFICATION_POLICY, using %s", cfg.Policy)
+		loaded.Policy = cfg.Policy
+	}
+	if loaded.TTL <= 0 {
+		return EmailVerification{}, errors.New("EMAIL_VERIFICATION_TTL must be positive")
+	}
+	if loaded.ResendInterval < 0 {
+		return EmailVerification{}, errors.New("EMAIL_VERIFICATION_RESEND_INTERVAL must not be negative")
+	}
+	return loaded, nil
+}
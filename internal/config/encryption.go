@@ -0,0 +1,18 @@
+package config
+
+import (
+	"os"
+
+	"github.com/SantiagoBedoya/otp-api/internal/encryption"
+)
+
+// LoadSecretKeyring reads SECRET_ENCRYPTION_KEYS, a comma separated list of
+// id:base64key entries with the newest key first. It returns nil when no
+// keys are configured.
+func LoadSecretKeyring() (*encryption.Keyring, error) {
+	value := os.Getenv("SECRET_ENCRYPTION_KEYS")
+	if value == "" {
+		return nil, nil
+	}
+	return encryption.ParseKeys(value)
+}
@@ -0,0 +1,36 @@
+package config
+
+import "log"
+
+type HOTP struct {
+	// LookAhead is the number of counter values checked past the stored
+	// one, for fob presses that never reached the server.
+	LookAhead int
+	// ResyncWindow is how far ahead two consecutive codes are searched
+	// when a fob drifted beyond LookAhead.
+	ResyncWindow int
+}
+
+func DefaultHOTP() HOTP {
+	return HOTP{
+		LookAhead:    10,
+		ResyncWindow: 1000,
+	}
+}
+
+func LoadHOTP() HOTP {
+	cfg := DefaultHOTP()
+	loaded := HOTP{
+		LookAhead:    getInt("HOTP_LOOK_AHEAD", cfg.LookAhead),
+		ResyncWindow: getInt("HOTP_RESYNC_WINDOW", cfg.ResyncWindow),
+	}
+	if loaded.LookAhead <= 0 {
+		log.Printf("Invalid value for HOTP_LOOK_AHEAD, using %d", cfg.LookAhead)
+		loaded.LookAhead = cfg.LookAhead
+	}
+	if loaded.ResyncWindow < loaded.LookAhead {
+		log.Printf("Invalid value for HOTP_RESYNC_WINDOW, using %d", cfg.ResyncWindow)
+		loaded.ResyncWindow = cfg.ResyncWindow
+	}
+	return loaded
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+type Lockout struct {
+	// Store selects the attempt storage, "mysql" or "memory".
+	Store            string
+	AccountThreshold int
+	IPThreshold      int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutDuration  time.Duration
+	// ResetAfter forgets failures older than this.
+	ResetAfter time.Duration
+}
+
+func DefaultLockout() Lockout {
+	return Lockout{
+		Store:            "mysql",
+		AccountThreshold: 5,
+		IPThreshold:      50,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutDuration:  time.Minute * 15,
+		ResetAfter:       time.Hour,
+	}
+}
+
+func LoadLockout() Lockout {
+	cfg := DefaultLockout()
+	loaded := Lockout{
+		Store:            getString("LOCKOUT_STORE", cfg.Store),
+		AccountThreshold: getInt("LOCKOUT_ACCOUNT_THRESHOLD", cfg.AccountThreshold),
+		IPThreshold:      getInt("LOCKOUT_IP_THRESHOLD", cfg.IPThreshold),
+		BaseDelay:        getDuration("LOCKOUT_BASE_DELAY", cfg.BaseDelay),
+		MaxDelay:         getDuration("LOCKOUT_MAX_DELAY", cfg.MaxDelay),
+		LockoutDuration:  getDuration("LOCKOUT_DURATION", cfg.LockoutDuration),
+		ResetAfter:       getDuration("LOCKOUT_RESET_AFTER", cfg.ResetAfter),
+	}
+	if loaded.Store != "mysql" && loaded.Store != "memory" {
+		log.Printf("Invalid value for LOCKOUT_STORE, using %s", cfg.Store)
+		loaded.Store = cfg.Store
+	}
+	if loaded.AccountThreshold <= 0 {
+		log.Printf("Invalid value for LOCKOUT_ACCOUNT_THRESHOLD, using %d", cfg.AccountThreshold)
+		loaded.AccountThreshold = cfg.AccountThreshold
+	}
+	if loaded.IPThreshold <= 0 {
+		log.Printf("Invalid value for LOCKOUT_IP_THRESHOLD, using %d", cfg.IPThreshold)
+		loaded.IPThreshold = cfg.IPThreshold
+	}
+	if loaded.BaseDelay < 0 {
+		log.Printf("Invalid value for LOCKOUT_BASE_DELAY, using %s", cfg.BaseDelay)
+		loaded.BaseDelay = cfg.BaseDelay
+	}
+	if loaded.MaxDelay < loaded.BaseDelay {
+		log.Printf("Invalid value for LOCKOUT_MAX_DELAY, using %s", loaded.BaseDelay)
+		loaded.MaxDelay = loaded.BaseDelay
+	}
+	if loaded.LockoutDuration <= 0 {
+		log.Printf("Invalid value for LOCKOUT_DURATION, using %s", cfg.LockoutDuration)
+		loaded.LockoutDuration = cfg.LockoutDuration
+	}
+	if loaded.ResetAfter <= 0 {
+		log.Printf("Invalid value for LOCKOUT_RESET_AFTER, using %s", cfg.ResetAfter)
+		loaded.ResetAfter = cfg.ResetAfter
+	}
+	return loaded
+}
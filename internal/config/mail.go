@@ -0,0 +1,70 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+type Mail struct {
+	// Driver is smtp, file or memory. The file driver writes every message
+	// to Dir, which is handy during development.
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
+}
+
+func DefaultMail() Mail {
+	return Mail{
+		Driver:   "file",
+		From:     "no-reply@otp-api.local",
+		SMTPPort: 587,
+		Dir:      "mail",
+	}
+}
+
+func LoadMail() Mail {
+	cfg := DefaultMail()
+	return Mail{
+		Driver:       getString("MAIL_DRIVER", cfg.Driver),
+		From:         getString("MAIL_FROM", cfg.From),
+		SMTPHost:     getString("SMTP_HOST", cfg.SMTPHost),
+		SMTPPort:     getInt("SMTP_PORT", cfg.SMTPPort),
+		SMTPUsername: getString("SMTP_USERNAME", cfg.SMTPUsername),
+		SMTPPassword: getString("SMTP_PASSWORD", cfg.SMTPPassword),
+		Dir:          getString("MAIL_DIR", cfg.Dir),
+	}
+}
+
+type EmailOTP struct {
+	TTL time.Duration
+	// ResendInterval is the minimum time between two codes for a user.
+	ResendInterval time.Duration
+}
+
+func DefaultEmailOTP() EmailOTP {
+	return EmailOTP{
+		TTL:            time.Minute * 10,
+		ResendInterval: time.Minute,
+	}
+}
+
+func LoadEmailOTP() EmailOTP {
+	cfg := DefaultEmailOTP()
+	loaded := EmailOTP{
+		TTL:            getDuration("EMAIL_OTP_TTL", cfg.TTL),
+		ResendInterval: getDuration("EMAIL_OTP_RESEND_INTERVAL", cfg.ResendInterval),
+	}
+	if loaded.TTL <= 0 {
+		log.Printf("Invalid value for EMAIL_OTP_TTL, using %s", cfg.TTL)
+		loaded.TTL = cfg.TTL
+	}
+	if loaded.ResendInterval < 0 {
+		log.Printf("Invalid value for EMAIL_OTP_RESEND_INTERVAL, using %s", cfg.ResendInterval)
+		loaded.ResendInterval = cfg.ResendInterval
+	}
+	return loaded
+}
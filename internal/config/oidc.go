@@ -0,0 +1,22 @@
+package config
+
+import "strings"
+
+type OIDC struct {
+	// Issuer is the public base URL of the API, used as the iss claim of
+	// ID tokens and to build the endpoints of the discovery document.
+	Issuer string
+}
+
+func DefaultOIDC() OIDC {
+	return OIDC{
+		Issuer: "http://localhost:8080",
+	}
+}
+
+func LoadOIDC() OIDC {
+	cfg := DefaultOIDC()
+	return OIDC{
+		Issuer: strings.TrimSuffix(getString("OIDC_ISSUER", cfg.Issuer), "/"),
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"math"
+)
+
+// Password hashing algorithms. Hashes made with bcrypt are upgraded to
+// argon2id when users sign in, never the other way round.
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+type PasswordHash struct {
+	// Algorithm is the one used for new hashes, see the constants above.
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is in KiB.
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+}
+
+// DefaultPasswordHash uses the argon2id parameters recommended by OWASP.
+func DefaultPasswordHash() PasswordHash {
+	return PasswordHash{
+		Algorithm:         PasswordHashArgon2id,
+		BcryptCost:        10,
+		Argon2Memory:      19 * 1024,
+		Argon2Iterations:  2,
+		Argon2Parallelism: 1,
+	}
+}
+
+// LoadPasswordHash rejects values the hashers cannot use. The argon2id
+// parameters are checked here since they are narrowed to uint32 and uint8.
+func LoadPasswordHash() (PasswordHash, error) {
+	cfg := DefaultPasswordHash()
+	loaded := PasswordHash{
+		Algorithm:         getString("PASSWORD_HASH_ALGORITHM", cfg.Algorithm),
+		BcryptCost:        getInt("BCRYPT_COST", cfg.BcryptCost),
+		Argon2Memory:      getInt("ARGON2_MEMORY", cfg.Argon2Memory),
+		Argon2Iterations:  getInt("ARGON2_ITERATIONS", cfg.Argon2Iterations),
+		Argon2Parallelism: getInt("ARGON2_PARALLELISM", cfg.Argon2Parallelism),
+	}
+	switch loaded.Algorithm {
+	case PasswordHashBcrypt, PasswordHashArgon2id:
+	default:
+		return PasswordHash{}, fmt.Errorf("PASSWORD_HASH_ALGORITHM must be %s or %s", PasswordHashBcrypt, PasswordHashArgon2id)
+	}
+	if loaded.Argon2Iterations < 1 || int64(loaded.Argon2Iterations) > math.MaxUint32 {
+		return PasswordHash{}, fmt.Errorf("ARGON2_ITERATIONS must be between 1 and %d", uint32(math.MaxUint32))
+	}
+	if loaded.Argon2Parallelism < 1 || loaded.Argon2Parallelism > math.MaxUint8 {
+		return PasswordHash{}, fmt.Errorf("ARGON2_PARALLELISM must be between 1 and %d", math.MaxUint8)
+	}
+	if loaded.Argon2Memory < 8*loaded.Argon2Parallelism || int64(loaded.Argon2Memory) > math.MaxUint32 {
+		return PasswordHash{}, fmt.Errorf("ARGON2_MEMORY must be between %d and %d KiB", 8*loaded.Argon2Parallelism, uint32(math.MaxUint32))
+	}
+	return loaded, nil
+}
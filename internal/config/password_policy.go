@@ -0,0 +1,57 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// bcryptMaxLength is the number of bytes bcrypt hashes, the rest of a
+// password is ignored.
+const bcryptMaxLength = 72
+
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength is counted in bytes, at most bcryptMaxLength when new
+	// passwords are hashed with bcrypt.
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// BreachedDir holds a breached password list split in SHA-1 prefix
+	// buckets. Passwords are not screened when it is empty.
+	BreachedDir string
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 72,
+	}
+}
+
+// LoadPasswordPolicy rejects lengths no password can meet, and a
+// MaxLength bcrypt would silently truncate when hash uses it for new
+// passwords.
+func LoadPasswordPolicy(hash PasswordHash) (PasswordPolicy, error) {
+	cfg := DefaultPasswordPolicy()
+	loaded := PasswordPolicy{
+		MinLength:     getInt("PASSWORD_MIN_LENGTH", cfg.MinLength),
+		MaxLength:     getInt("PASSWORD_MAX_LENGTH", cfg.MaxLength),
+		RequireLower:  getBool("PASSWORD_REQUIRE_LOWER", cfg.RequireLower),
+		RequireUpper:  getBool("PASSWORD_REQUIRE_UPPER", cfg.RequireUpper),
+		RequireDigit:  getBool("PASSWORD_REQUIRE_DIGIT", cfg.RequireDigit),
+		RequireSymbol: getBool("PASSWORD_REQUIRE_SYMBOL", cfg.RequireSymbol),
+		BreachedDir:   getString("BREACHED_PASSWORDS_DIR", cfg.BreachedDir),
+	}
+	if loaded.MinLength < 1 {
+		return PasswordPolicy{}, errors.New("PASSWORD_MIN_LENGTH must be at least 1")
+	}
+	if loaded.MaxLength < loaded.MinLength {
+		return PasswordPolicy{}, errors.New("PASSWORD_MAX_LENGTH must not be less than PASSWORD_MIN_LENGTH")
+	}
+	if hash.Algorithm == PasswordHashBcrypt && loaded.MaxLength > bcryptMaxLength {
+		return PasswordPolicy{}, fmt.Errorf("PASSWORD_MAX_LENGTH must be at most %d with bcrypt", bcryptMaxLength)
+	}
+	return loaded, nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+type PasswordReset struct {
+	TTL time.Duration
+	// ResendInterval is the minimum time between two reset emails for a
+	// user.
+	ResendInterval time.Duration
+	// URL is the page where users choose their new password, the reset
+	// token is added as the token query parameter.
+	URL string
+}
+
+func DefaultPasswordReset() PasswordReset {
+	return PasswordReset{
+		TTL:            time.Minute * 30,
+		ResendInterval: time.Minute,
+		URL:            "http://localhost:3000/reset-password",
+	}
+}
+
+// LoadPasswordReset rejects a TTL that would issue expired links and a
+// negative ResendInterval, which would turn off the throttling.
+func LoadPasswordReset() (PasswordReset, error) {
+	cfg := DefaultPasswordReset()
+	loaded := PasswordReset{
+		TTL:            getDuration("PASSWORD_RESET_TTL", cfg.TTL),
+		ResendInterval: getDuration("PASSWORD_RESET_RESEND_INTERVAL", cfg.ResendInterval),
+		URL:            getString("PASSWORD_RESET_URL", cfg.URL),
+	}
+	if loaded.TTL <= 0 {
+		return PasswordReset{}, errors.New("PASSWORD_RESET_TTL must be positive")
+	}
+	if loaded.ResendInterval < 0 {
+		return PasswordReset{}, errors.New("PASSWORD_RESET_RESEND_INTERVAL must not be negative")
+	}
+	return loaded, nil
+}
@@ -0,0 +1,21 @@
+package config
+
+type Server struct {
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies
+	// in front of the API. The client IP, which the lockout throttles on,
+	// is only read from X-Forwarded-For when the request comes from one of
+	// them. Leave it empty when clients connect directly, otherwise any
+	// client could pick its own IP.
+	TrustedProxies []string
+}
+
+func DefaultServer() Server {
+	return Server{}
+}
+
+func LoadServer() Server {
+	cfg := DefaultServer()
+	return Server{
+		TrustedProxies: getList("TRUSTED_PROXIES", cfg.TrustedProxies),
+	}
+}
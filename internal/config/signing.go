@@ -0,0 +1,18 @@
+package config
+
+import (
+	"os"
+
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
+)
+
+// LoadSigningKeys reads JWT_SIGNING_KEYS, a comma separated list of
+// kid:path entries pointing to PEM files with the signing key first.
+// Without it tokens keep being signed with HS256 and JWT_SECRET.
+func LoadSigningKeys() (*signing.KeySet, error) {
+	value := os.Getenv("JWT_SIGNING_KEYS")
+	if value == "" {
+		return signing.NewHMACKeySet([]byte(os.Getenv("JWT_SECRET"))), nil
+	}
+	return signing.LoadKeySet(value)
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+type SMS struct {
+	// Driver is webhook or fake. The fake driver only logs that a message
+	// was sent and must not be used in production.
+	Driver         string
+	WebhookURL     string
+	WebhookToken   string
+	WebhookTimeout time.Duration
+}
+
+func DefaultSMS() SMS {
+	return SMS{
+		Driver:         "fake",
+		WebhookTimeout: time.Second * 10,
+	}
+}
+
+func LoadSMS() SMS {
+	cfg := DefaultSMS()
+	return SMS{
+		Driver:         getString("SMS_DRIVER", cfg.Driver),
+		WebhookURL:     getString("SMS_WEBHOOK_URL", cfg.WebhookURL),
+		WebhookToken:   getString("SMS_WEBHOOK_TOKEN", cfg.WebhookToken),
+		WebhookTimeout: getDuration("SMS_WEBHOOK_TIMEOUT", cfg.WebhookTimeout),
+	}
+}
+
+type SMSOTP struct {
+	TTL time.Duration
+	// ResendInterval is the minimum time between two codes for a user and
+	// MaxPerHour caps how many codes a user can be texted in an hour.
+	ResendInterval time.Duration
+	MaxPerHour     int
+}
+
+func DefaultSMSOTP() SMSOTP {
+	return SMSOTP{
+		TTL:            time.Minute * 5,
+		ResendInterval: time.Minute,
+		MaxPerHour:     5,
+	}
+}
+
+func LoadSMSOTP() SMSOTP {
+	cfg := DefaultSMSOTP()
+	loaded := SMSOTP{
+		TTL:            getDuration("SMS_OTP_TTL", cfg.TTL),
+		ResendInterval: getDuration("SMS_OTP_RESEND_INTERVAL", cfg.ResendInterval),
+		MaxPerHour:     getInt("SMS_OTP_MAX_PER_HOUR", cfg.MaxPerHour),
+	}
+	if loaded.TTL <= 0 {
+		log.Printf("Invalid value for SMS_OTP_TTL, using %s", cfg.TTL)
+		loaded.TTL = cfg.TTL
+	}
+	if loaded.ResendInterval < 0 {
+		log.Printf("Invalid value for SMS_OTP_RESEND_INTERVAL, using %s", cfg.ResendInterval)
+		loaded.ResendInterval = cfg.ResendInterval
+	}
+	if loaded.MaxPerHour <= 0 {
+		log.Printf("Invalid value for SMS_OTP_MAX_PER_HOUR, using %d", cfg.MaxPerHour)
+		loaded.MaxPerHour = cfg.MaxPerHour
+	}
+	return loaded
+}
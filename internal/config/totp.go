@@ -0,0 +1,58 @@
+package config
+
+import (
+	"log"
+	"strings"
+)
+
+type TOTP struct {
+	Issuer    string
+	Algorithm string
+	Digits    int
+	Period    uint
+	// Skew is the number of periods accepted before and after the current one.
+	Skew uint
+}
+
+func DefaultTOTP() TOTP {
+	return TOTP{
+		Issuer:    "otp-api",
+		Algorithm: "SHA1",
+		Digits:    6,
+		Period:    30,
+		Skew:      1,
+	}
+}
+
+func LoadTOTP() TOTP {
+	cfg := DefaultTOTP()
+	loaded := TOTP{
+		Issuer:    getString("TOTP_ISSUER", cfg.Issuer),
+		Algorithm: strings.ToUpper(getString("TOTP_ALGORITHM", cfg.Algorithm)),
+		Digits:    getInt("TOTP_DIGITS", cfg.Digits),
+		Period:    cfg.Period,
+		Skew:      cfg.Skew,
+	}
+	// Checked before the conversion, a negative value would wrap around.
+	if period := getInt("TOTP_PERIOD", int(cfg.Period)); period > 0 {
+		loaded.Period = uint(period)
+	} else {
+		log.Printf("Invalid value for TOTP_PERIOD, using %d", cfg.Period)
+	}
+	if skew := getInt("TOTP_SKEW", int(cfg.Skew)); skew >= 0 {
+		loaded.Skew = uint(skew)
+	} else {
+		log.Printf("Invalid value for TOTP_SKEW, using %d", cfg.Skew)
+	}
+	switch loaded.Algorithm {
+	case "SHA1", "SHA256", "SHA512":
+	default:
+		log.Printf("Invalid value for TOTP_ALGORITHM, using %s", cfg.Algorithm)
+		loaded.Algorithm = cfg.Algorithm
+	}
+	if loaded.Digits != 6 && loaded.Digits != 8 {
+		log.Printf("Invalid value for TOTP_DIGITS, using %d", cfg.Digits)
+		loaded.Digits = cfg.Digits
+	}
+	return loaded
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+type TrustedDevice struct {
+	// TTL is how long a device remembered after a successful 2FA check can
+	// skip the second factor on sign in.
+	TTL time.Duration
+}
+
+func DefaultTrustedDevice() TrustedDevice {
+	return TrustedDevice{
+		TTL: time.Hour * 24 * 30,
+	}
+}
+
+func LoadTrustedDevice() TrustedDevice {
+	cfg := DefaultTrustedDevice()
+	loaded := TrustedDevice{
+		TTL: getDuration("TRUSTED_DEVICE_TTL", cfg.TTL),
+	}
+	if loaded.TTL <= 0 {
+		log.Printf("Invalid value for TRUSTED_DEVICE_TTL, using %s", cfg.TTL)
+		loaded.TTL = cfg.TTL
+	}
+	return loaded
+}
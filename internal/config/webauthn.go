@@ -0,0 +1,51 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+type WebAuthn struct {
+	RPID   string
+	RPName string
+	// Origins are the exact origins, scheme and port included, allowed to
+	// run the ceremonies.
+	Origins []string
+	Timeout time.Duration
+	// UserVerification is required, preferred or discouraged. Passkey
+	// sign-in always requires it.
+	UserVerification string
+	// RegistrationMaxAge is how recent the sign-in must be to register a
+	// new credential.
+	RegistrationMaxAge time.Duration
+}
+
+func DefaultWebAuthn() WebAuthn {
+	return WebAuthn{
+		RPID:               "localhost",
+		RPName:             "otp-api",
+		Origins:            []string{"http://localhost:8080"},
+		Timeout:            time.Minute * 5,
+		UserVerification:   "preferred",
+		RegistrationMaxAge: time.Minute * 10,
+	}
+}
+
+func LoadWebAuthn() WebAuthn {
+	cfg := DefaultWebAuthn()
+	loaded := WebAuthn{
+		RPID:               getString("WEBAUTHN_RP_ID", cfg.RPID),
+		RPName:             getString("WEBAUTHN_RP_NAME", cfg.RPName),
+		Origins:            getList("WEBAUTHN_ORIGINS", cfg.Origins),
+		Timeout:            getDuration("WEBAUTHN_TIMEOUT", cfg.Timeout),
+		UserVerification:   getString("WEBAUTHN_USER_VERIFICATION", cfg.UserVerification),
+		RegistrationMaxAge: getDuration("WEBAUTHN_REGISTRATION_MAX_AGE", cfg.RegistrationMaxAge),
+	}
+	switch loaded.UserVerification {
+	case "required", "preferred", "discouraged":
+	default:
+		log.Printf("Invalid value for WEBAUTHN_USER_VERIFICATION, using %s", cfg.UserVerification)
+		loaded.UserVerification = cfg.UserVerification
+	}
+	return loaded
+}
@@ -0,0 +1,15 @@
+package dto
+
+// ChangePasswordDto carries the current password and a second factor in
+// VerifyIdentityDto.
+type ChangePasswordDto struct {
+	NewPassword string `json:"new_password"`
+	VerifyIdentityDto
+}
+
+// ChangeEmailDto asks to move the account to Email, the user proves their
+// identity the same way.
+type ChangeEmailDto struct {
+	Email string `json:"email"`
+	VerifyIdentityDto
+}
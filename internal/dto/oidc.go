@@ -0,0 +1,95 @@
+package dto
+
+type AuthorizeRequestDto struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+type AuthorizeDto struct {
+	AuthorizeRequestDto
+	Email        string `form:"email"`
+	Password     string `form:"password"`
+	Code         string `form:"code"`
+	RecoveryCode string `form:"recovery_code"`
+}
+
+type TokenRequestDto struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+type OIDCTokenDto struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type UserInfoDto struct {
+	Subject    string `json:"sub"`
+	Email      string `json:"email,omitempty"`
+	Name       string `json:"name,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+}
+
+type OpenIDConfigurationDto struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+type IntrospectDto struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+type RevokeTokenDto struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+type IntrospectionDto struct {
+	Active     bool     `json:"active"`
+	Scope      string   `json:"scope,omitempty"`
+	ClientID   string   `json:"client_id,omitempty"`
+	TokenType  string   `json:"token_type,omitempty"`
+	Subject    string   `json:"sub,omitempty"`
+	Expiration int64    `json:"exp,omitempty"`
+	IssuedAt   int64    `json:"iat,omitempty"`
+	Issuer     string   `json:"iss,omitempty"`
+	JTI        string   `json:"jti,omitempty"`
+	SessionID  string   `json:"sid,omitempty"`
+	AMR        []string `json:"amr,omitempty"`
+	ACR        string   `json:"acr,omitempty"`
+	AuthTime   int64    `json:"auth_time,omitempty"`
+}
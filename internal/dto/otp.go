@@ -1,5 +1,92 @@
 package dto
 
+import "time"
+
+// OTPDto carries a code or a recovery code. RememberDevice asks for a
+// device token that skips the second factor on the next sign ins, named
+// DeviceName or after the User-Agent.
 type OTPDto struct {
-	Code string `json:"code"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	RememberDevice bool   `json:"remember_device"`
+	DeviceName     string `json:"device_name"`
+}
+
+type RecoveryCodesDto struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type VerifyIdentityDto struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TOTPOptionsDto names a new authenticator app and picks its parameters.
+// Empty values use the server defaults.
+type TOTPOptionsDto struct {
+	Name      string `json:"name" form:"name"`
+	Algorithm string `json:"algorithm" form:"algorithm"`
+	Digits    int    `json:"digits" form:"digits"`
+	Period    uint   `json:"period" form:"period"`
+}
+
+type TOTPEnrollDto struct {
+	TOTPOptionsDto
+	VerifyIdentityDto
+}
+
+type SMSEnrollDto struct {
+	Phone string `json:"phone"`
+	VerifyIdentityDto
+}
+
+// HOTPCodesDto carries two consecutive codes from an HOTP fob.
+type HOTPCodesDto struct {
+	FirstCode  string `json:"first_code"`
+	SecondCode string `json:"second_code"`
+}
+
+// HOTPEnrollDto registers a fob from the secret its vendor supplied.
+// Counter is where to start searching for the two codes, Digits and
+// Algorithm default to 6 and SHA1.
+type HOTPEnrollDto struct {
+	Name      string `json:"name"`
+	Secret    string `json:"secret"`
+	Counter   uint64 `json:"counter"`
+	Digits    int    `json:"digits"`
+	Algorithm string `json:"algorithm"`
+	HOTPCodesDto
+	VerifyIdentityDto
+}
+
+type FactorDto struct {
+	ID         int64      `json:"id"`
+	Type       string     `json:"type"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type RenameFactorDto struct {
+	Name string `json:"name"`
+}
+
+type TrustedDeviceDto struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type OTPSetupDto struct {
+	URL         string `json:"otpauth_url"`
+	Secret      string `json:"secret"`
+	Issuer      string `json:"issuer"`
+	AccountName string `json:"account_name"`
+	Algorithm   string `json:"algorithm"`
+	Digits      int    `json:"digits"`
+	Period      uint64 `json:"period"`
+	QRCode      string `json:"qr_code"`
 }
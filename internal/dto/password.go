@@ -0,0 +1,14 @@
+package dto
+
+type ForgotPasswordDto struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordDto sets a new password with the token from a reset email.
+// Accounts with 2FA also need a code or a recovery code.
+type ResetPasswordDto struct {
+	Token        string `json:"token"`
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
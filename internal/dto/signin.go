@@ -1,6 +1,9 @@
 package dto
 
+// SignInDto may carry the device token of a trusted device, which skips
+// the second factor.
 type SignInDto struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	DeviceToken string `json:"device_token"`
 }
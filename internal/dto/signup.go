@@ -6,3 +6,11 @@ type SignUpDto struct {
 	Email     string `json:"email"`
 	Password  string `json:"password"`
 }
+
+type ResendVerificationDto struct {
+	Email string `json:"email"`
+}
+
+type VerifyEmailDto struct {
+	Token string `json:"token"`
+}
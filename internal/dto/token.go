@@ -0,0 +1,16 @@
+package dto
+
+type TokenDto struct {
+	AccessToken   string   `json:"access_token,omitempty"`
+	RefreshToken  string   `json:"refresh_token,omitempty"`
+	ExpiresIn     int64    `json:"expires_in,omitempty"`
+	MFAToken      string   `json:"mfa_token,omitempty"`
+	MFARequired   bool     `json:"mfa_required,omitempty"`
+	MFAMethod     string   `json:"mfa_method,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	DeviceToken   string   `json:"device_token,omitempty"`
+}
+
+type RefreshTokenDto struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,77 @@
+package dto
+
+import "time"
+
+// The WebAuthn DTOs follow the JSON serialization of the Web Authentication
+// API, binary values are unpadded base64url strings.
+
+type RelyingPartyDto struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUserDto struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameterDto struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptorDto struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelectionDto struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type CredentialCreationOptionsDto struct {
+	Challenge              string                    `json:"challenge"`
+	RP                     RelyingPartyDto           `json:"rp"`
+	User                   WebAuthnUserDto           `json:"user"`
+	PubKeyCredParams       []CredentialParameterDto  `json:"pubKeyCredParams"`
+	Timeout                int64                     `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptorDto `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelectionDto `json:"authenticatorSelection"`
+	Attestation            string                    `json:"attestation"`
+}
+
+type CredentialRequestOptionsDto struct {
+	Challenge        string                    `json:"challenge"`
+	Timeout          int64                     `json:"timeout"`
+	RPID             string                    `json:"rpId"`
+	AllowCredentials []CredentialDescriptorDto `json:"allowCredentials"`
+	UserVerification string                    `json:"userVerification"`
+}
+
+type AuthenticatorResponseDto struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject,omitempty"`
+	Transports        []string `json:"transports,omitempty"`
+	AuthenticatorData string   `json:"authenticatorData,omitempty"`
+	Signature         string   `json:"signature,omitempty"`
+	UserHandle        string   `json:"userHandle,omitempty"`
+}
+
+type PublicKeyCredentialDto struct {
+	ID       string                   `json:"id"`
+	RawID    string                   `json:"rawId"`
+	Type     string                   `json:"type"`
+	Response AuthenticatorResponseDto `json:"response"`
+}
+
+// WebAuthnCredentialDto describes a registered security key or passkey.
+type WebAuthnCredentialDto struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,126 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownKey        = errors.New("encryption key is not configured")
+	ErrInvalidCiphertext = errors.New("ciphertext is malformed")
+)
+
+// Keyring encrypts values with AES-GCM under its current key and decrypts
+// values sealed by any of its keys. Sealed values look like
+// "<key id>:<base64 nonce+ciphertext>", so the key used travels with the
+// ciphertext.
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from AES keys indexed by id. current is the
+// id used for new encryptions.
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, current)
+	}
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		aeads[id] = aead
+	}
+	return &Keyring{
+		current: current,
+		aeads:   aeads,
+	}, nil
+}
+
+// ParseKeys reads "id:base64key" entries separated by commas. The first
+// entry is the current key.
+func ParseKeys(value string) (*Keyring, error) {
+	var current string
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key entry %q, expected id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if current == "" {
+			current = id
+		}
+		keys[id] = key
+	}
+	if current == "" {
+		return nil, ErrUnknownKey
+	}
+	return NewKeyring(current, keys)
+}
+
+func (k *Keyring) CurrentKeyID() string {
+	return k.current
+}
+
+// Encrypt seals plaintext under the current key. aad is authenticated but
+// not stored, the same value has to be given to Decrypt.
+func (k *Keyring) Encrypt(plaintext, aad []byte) (string, error) {
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, aad)
+	return k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) Decrypt(value string, aad []byte) ([]byte, error) {
+	id, encoded, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, ErrInvalidCiphertext
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+// IsEncrypted reports whether value was produced by Encrypt, as opposed to
+// a plain value stored before encryption was enabled.
+func IsEncrypted(value string) bool {
+	return strings.Contains(value, ":")
+}
+
+// KeyID returns the id of the key value was sealed with.
+func KeyID(value string) string {
+	id, _, _ := strings.Cut(value, ":")
+	return id
+}
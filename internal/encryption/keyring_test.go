@@ -0,0 +1,62 @@
+package encryption_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SantiagoBedoya/otp-api/internal/encryption"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	newKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32)))
+
+	old, err := encryption.ParseKeys("k1:" + oldKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sealed, err := old.Encrypt([]byte("JBSWY3DPEHPK3PXP"), []byte("user:1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if encryption.KeyID(sealed) != "k1" {
+		t.Errorf("expected key id k1, got %q", encryption.KeyID(sealed))
+	}
+
+	rotated, err := encryption.ParseKeys("k2:" + newKey + ",k1:" + oldKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rotated.CurrentKeyID() != "k2" {
+		t.Errorf("expected current key k2, got %q", rotated.CurrentKeyID())
+	}
+	plaintext, err := rotated.Decrypt(sealed, []byte("user:1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(plaintext) != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("unexpected plaintext %q", plaintext)
+	}
+	if _, err := rotated.Decrypt(sealed, []byte("user:2")); err == nil {
+		t.Error("expected an error decrypting with a different aad")
+	}
+
+	retired, err := encryption.ParseKeys("k2:" + newKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := retired.Decrypt(sealed, []byte("user:1")); !errors.Is(err, encryption.ErrUnknownKey) {
+		t.Errorf("expected error: %v, got %v", encryption.ErrUnknownKey, err)
+	}
+}
+
+func TestParseKeysInvalid(t *testing.T) {
+	if _, err := encryption.ParseKeys("k1:" + base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("expected an error for an invalid key size")
+	}
+	if _, err := encryption.ParseKeys("missing-separator"); err == nil {
+		t.Error("expected an error for a malformed entry")
+	}
+}
@@ -1,13 +1,27 @@
 package handler
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
 	"github.com/SantiagoBedoya/otp-api/internal/service"
 	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp"
+)
+
+const (
+	mimePNG           = "image/png"
+	mimeSVG           = "image/svg+xml"
+	defaultQRCodeSize = 200
+	minQRCodeSize     = 100
+	maxQRCodeSize     = 1000
 )
 
 type AuthHandler struct {
@@ -29,10 +43,100 @@ func (h *AuthHandler) ValidateOTP(ctx *gin.Context) {
 		})
 		return
 	}
+	if data.DeviceName == "" {
+		data.DeviceName = ctx.Request.UserAgent()
+	}
 	userID := ctx.GetString("userID")
-	token, err := h.service.Validate2FA(userID, &data)
+	tokens, err := h.service.Validate2FA(userID, &data, ctx.ClientIP())
 	if err != nil {
 		log.Printf("Error validating 2FA: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidPasscode) || errors.Is(err, service.ErrInvalidRecoveryCode) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrMFANotEnabled) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) EnrollEmail(ctx *gin.Context) {
+	var data dto.VerifyIdentityDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding email enroll data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.service.EnrollEmail2FA(userID, &data, ctx.ClientIP()); err != nil {
+		log.Printf("Error enrolling email 2FA: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (h *AuthHandler) RequestEmailOTP(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if err := h.service.RequestEmailOTP(userID); err != nil {
+		log.Printf("Error sending email code: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrEmailOTPNotEnabled) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (h *AuthHandler) VerifyEmailOTP(ctx *gin.Context) {
+	var data dto.OTPDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding otp data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	tokens, err := h.service.VerifyEmailOTP(userID, &data, ctx.ClientIP())
+	if err != nil {
+		log.Printf("Error verifying email code: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
 		if errors.Is(err, service.ErrInvalidPasscode) {
 			ctx.JSON(http.StatusUnauthorized, gin.H{
 				"message": err.Error(),
@@ -44,32 +148,632 @@ func (h *AuthHandler) ValidateOTP(ctx *gin.Context) {
 		})
 		return
 	}
-	ctx.JSON(http.StatusOK, gin.H{
-		"access_token": token,
-	})
+	ctx.JSON(http.StatusOK, tokens)
 }
 
-func (h *AuthHandler) Generate(ctx *gin.Context) {
+func (h *AuthHandler) EnrollSMS(ctx *gin.Context) {
+	var data dto.SMSEnrollDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding sms enroll data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.service.EnrollSMS2FA(userID, &data, ctx.ClientIP()); err != nil {
+		log.Printf("Error enrolling SMS 2FA: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidPhone) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (h *AuthHandler) RequestSMSOTP(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if err := h.service.RequestSMSOTP(userID); err != nil {
+		log.Printf("Error sending SMS code: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrSMSOTPNotEnabled) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (h *AuthHandler) VerifySMSOTP(ctx *gin.Context) {
+	var data dto.OTPDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding otp data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	tokens, err := h.service.VerifySMSOTP(userID, &data, ctx.ClientIP())
+	if err != nil {
+		log.Printf("Error verifying SMS code: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidPasscode) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) EnrollHOTP(ctx *gin.Context) {
+	var data dto.HOTPEnrollDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding hotp enroll data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	tokens, err := h.service.EnrollHOTP2FA(userID, &data, ctx.ClientIP())
+	if err != nil {
+		log.Printf("Error enrolling HOTP 2FA: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidHOTPSecret) ||
+			errors.Is(err, service.ErrHOTPNotSynchronized) ||
+			errors.Is(err, service.ErrInvalidFactorName) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) ResyncHOTP(ctx *gin.Context) {
+	var data dto.HOTPCodesDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding hotp codes: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	tokens, err := h.service.ResyncHOTP(userID, &data, ctx.ClientIP())
+	if err != nil {
+		log.Printf("Error resynchronizing HOTP: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrHOTPNotEnabled) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidPasscode) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) ListFactors(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	factors, err := h.service.ListFactors(userID)
+	if err != nil {
+		log.Printf("Error listing factors: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, factors)
+}
+
+func (h *AuthHandler) RenameFactor(ctx *gin.Context) {
+	id, ok := factorID(ctx)
+	if !ok {
+		return
+	}
+	var data dto.RenameFactorDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding rename factor data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.service.RenameFactor(userID, ctx.Query("type"), id, &data); err != nil {
+		log.Printf("Error renaming factor: %v", err)
+		if errors.Is(err, service.ErrInvalidFactorName) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrFactorNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) DeleteFactor(ctx *gin.Context) {
+	id, ok := factorID(ctx)
+	if !ok {
+		return
+	}
+	var data dto.VerifyIdentityDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding delete factor data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
 	userID := ctx.GetString("userID")
-	user, err := h.service.GetUserByID(userID)
+	if err := h.service.DeleteFactor(userID, ctx.Query("type"), id, &data, ctx.ClientIP()); err != nil {
+		log.Printf("Error deleting factor: %v", err)
+		if errors.Is(err, service.ErrFactorNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func factorID(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
 	if err != nil {
-		log.Printf("Error getting user by ID: %v", err)
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"message": service.ErrFactorNotFound.Error(),
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *AuthHandler) ListTrustedDevices(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	devices, err := h.service.ListTrustedDevices(userID)
+	if err != nil {
+		log.Printf("Error listing trusted devices: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"message": "Something went wrong",
 		})
 		return
 	}
-	imageBytes, err := h.service.Setup2FA(userID, user.Email)
+	ctx.JSON(http.StatusOK, devices)
+}
+
+func (h *AuthHandler) RevokeTrustedDevice(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"message": service.ErrTrustedDeviceNotFound.Error(),
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.service.RevokeTrustedDevice(userID, id); err != nil {
+		log.Printf("Error revoking trusted device: %v", err)
+		if errors.Is(err, service.ErrTrustedDeviceNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) RevokeTrustedDevices(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if err := h.service.RevokeTrustedDevices(userID); err != nil {
+		log.Printf("Error revoking trusted devices: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var data dto.OTPDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding otp data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	codes, err := h.service.RegenerateRecoveryCodes(userID, &data, ctx.ClientIP())
+	if err != nil {
+		log.Printf("Error regenerating recovery codes: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidPasscode) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrMFANotEnabled) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, dto.RecoveryCodesDto{RecoveryCodes: codes})
+}
+
+func (h *AuthHandler) RefreshToken(ctx *gin.Context) {
+	var data dto.RefreshTokenDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding refresh token data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	tokens, err := h.service.RefreshToken(&data)
+	if err != nil {
+		log.Printf("Error refreshing token: %v", err)
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) ForgotPassword(ctx *gin.Context) {
+	var data dto.ForgotPasswordDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding forgot password data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	if err := h.service.ForgotPassword(&data); err != nil {
+		log.Printf("Error sending password reset: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (h *AuthHandler) ResetPassword(ctx *gin.Context) {
+	var data dto.ResetPasswordDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding reset password data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	if err := h.service.ResetPassword(&data, ctx.ClientIP()); err != nil {
+		log.Printf("Error resetting password: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
+		if passwordError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrMFARequired) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) SignOut(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*model.Claims)
+	if err := h.service.SignOut(claims); err != nil {
+		log.Printf("Error doing signOut: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) SignOutAll(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if err := h.service.SignOutAll(userID); err != nil {
+		log.Printf("Error doing signOut of all sessions: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) Generate(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	size, ok := qrCodeSize(ctx)
+	if !ok {
+		return
+	}
+	var data dto.TOTPOptionsDto
+	if err := ctx.ShouldBindQuery(&data); err != nil {
+		log.Printf("Error binding 2FA setup options: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	key, err := h.service.Setup2FA(userID, &data)
 	if err != nil {
 		log.Printf("Error doing the setup of 2FA: %v", err)
+		if errors.Is(err, service.ErrInvalidFactorName) || errors.Is(err, service.ErrInvalidTOTPParams) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"message": "Something went wrong",
 		})
 		return
 	}
+	h.writeOTPSetup(ctx, key, size)
+}
 
-	ctx.Header("Content-Type", "image/png")
-	_, _ = ctx.Writer.Write(imageBytes)
+func (h *AuthHandler) Reenroll(ctx *gin.Context) {
+	var data dto.TOTPEnrollDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding re-enroll data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	size, ok := qrCodeSize(ctx)
+	if !ok {
+		return
+	}
+	userID := ctx.GetString("userID")
+	key, err := h.service.Reenroll2FA(userID, &data, ctx.ClientIP())
+	if err != nil {
+		log.Printf("Error re-enrolling 2FA: %v", err)
+		if errors.Is(err, service.ErrInvalidFactorName) || errors.Is(err, service.ErrInvalidTOTPParams) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	h.writeOTPSetup(ctx, key, size)
+}
+
+// writeOTPSetup renders the new key as a PNG or SVG QR code, or as JSON
+// with everything needed to deep-link or type the key manually.
+func (h *AuthHandler) writeOTPSetup(ctx *gin.Context, key *otp.Key, size int) {
+	var (
+		body []byte
+		err  error
+	)
+	format := ctx.NegotiateFormat(mimePNG, gin.MIMEJSON, mimeSVG)
+	if format == mimeSVG {
+		body, err = service.QRCodeSVG(key, size)
+	} else {
+		body, err = service.QRCodePNG(key, size)
+	}
+	if err != nil {
+		log.Printf("Error rendering the QR code: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	switch format {
+	case gin.MIMEJSON:
+		ctx.JSON(http.StatusOK, dto.OTPSetupDto{
+			URL:         key.URL(),
+			Secret:      key.Secret(),
+			Issuer:      key.Issuer(),
+			AccountName: key.AccountName(),
+			Algorithm:   key.Algorithm().String(),
+			Digits:      key.Digits().Length(),
+			Period:      key.Period(),
+			QRCode:      "data:image/png;base64," + base64.StdEncoding.EncodeToString(body),
+		})
+	case mimeSVG:
+		ctx.Data(http.StatusOK, mimeSVG, body)
+	default:
+		ctx.Data(http.StatusOK, mimePNG, body)
+	}
+}
+
+func qrCodeSize(ctx *gin.Context) (int, bool) {
+	value := ctx.Query("size")
+	if value == "" {
+		return defaultQRCodeSize, true
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < minQRCodeSize || size > maxQRCodeSize {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": fmt.Sprintf("size must be between %d and %d", minQRCodeSize, maxQRCodeSize),
+		})
+		return 0, false
+	}
+	return size, true
+}
+
+func (h *AuthHandler) Disable(ctx *gin.Context) {
+	var data dto.VerifyIdentityDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding disable 2FA data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.service.Disable2FA(userID, &data, ctx.ClientIP()); err != nil {
+		log.Printf("Error disabling 2FA: %v", err)
+		identityError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// passwordError answers with the rules of the password policy a new
+// password breaks.
+func passwordError(ctx *gin.Context, err error) bool {
+	var policyErr *service.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		violations := make([]string, len(policyErr.Violations))
+		for i, v := range policyErr.Violations {
+			violations[i] = v.Error()
+		}
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message":    service.ErrWeakPassword.Error(),
+			"violations": violations,
+		})
+		return true
+	}
+	if errors.Is(err, service.ErrPasswordRequired) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return true
+	}
+	return false
+}
+
+func identityError(ctx *gin.Context, err error) {
+	if lockoutError(ctx, err) {
+		return
+	}
+	if errors.Is(err, service.ErrInvalidPassword) ||
+		errors.Is(err, service.ErrInvalidPasscode) ||
+		errors.Is(err, service.ErrInvalidRecoveryCode) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrMFANotEnabled) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{
+		"message": "Something went wrong",
+	})
 }
 
 func (h *AuthHandler) SignIn(ctx *gin.Context) {
@@ -81,9 +785,12 @@ func (h *AuthHandler) SignIn(ctx *gin.Context) {
 		})
 		return
 	}
-	token, err := h.service.SignIn(&data)
+	tokens, err := h.service.SignIn(&data, ctx.ClientIP())
 	if err != nil {
 		log.Printf("Error doing signIn: %v", err)
+		if lockoutError(ctx, err) {
+			return
+		}
 		if errors.Is(err, service.ErrInvalidPassword) {
 			ctx.JSON(http.StatusUnauthorized, gin.H{
 				"message": err.Error(),
@@ -96,14 +803,18 @@ func (h *AuthHandler) SignIn(ctx *gin.Context) {
 			})
 			return
 		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"message": "Something went wrong",
 		})
 		return
 	}
-	ctx.JSON(http.StatusOK, gin.H{
-		"access_token": token,
-	})
+	ctx.JSON(http.StatusOK, tokens)
 }
 
 func (h *AuthHandler) SignUp(ctx *gin.Context) {
@@ -118,6 +829,9 @@ func (h *AuthHandler) SignUp(ctx *gin.Context) {
 	user, err := h.service.SaveUser(&data)
 	if err != nil {
 		log.Printf("Error saving user: %v", err)
+		if passwordError(ctx, err) {
+			return
+		}
 		if errors.Is(err, service.ErrEmailInUse) {
 			ctx.JSON(http.StatusBadRequest, gin.H{
 				"message": err.Error(),
@@ -129,5 +843,76 @@ func (h *AuthHandler) SignUp(ctx *gin.Context) {
 		})
 		return
 	}
+	// The account exists by now, the user can ask for another link.
+	if err := h.service.SendVerificationEmail(user); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
 	ctx.JSON(http.StatusCreated, user)
 }
+
+func (h *AuthHandler) VerifyEmail(ctx *gin.Context) {
+	var data dto.VerifyEmailDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding verify email data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	if err := h.service.VerifyEmail(&data); err != nil {
+		log.Printf("Error verifying email: %v", err)
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) ResendVerification(ctx *gin.Context) {
+	var data dto.ResendVerificationDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding resend verification data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	if err := h.service.ResendVerificationEmail(&data); err != nil {
+		log.Printf("Error resending verification email: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// lockoutError writes a 423 for locked accounts or a 429 when the caller is
+// being throttled, with the wait in Retry-After.
+func lockoutError(ctx *gin.Context, err error) bool {
+	var lockoutErr *service.LockoutError
+	if !errors.As(err, &lockoutErr) {
+		return false
+	}
+	ctx.JSON(lockoutStatus(ctx, lockoutErr), gin.H{
+		"message": err.Error(),
+	})
+	return true
+}
+
+// lockoutStatus sets Retry-After and returns 423 for a locked account or
+// 429 for a throttled caller.
+func lockoutStatus(ctx *gin.Context, lockoutErr *service.LockoutError) int {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockoutErr.RetryAfter.Seconds()))))
+	if lockoutErr.Locked {
+		return http.StatusLocked
+	}
+	return http.StatusTooManyRequests
+}
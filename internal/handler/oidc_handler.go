@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<label>Email <input type="email" name="email" value="{{.Email}}" required></label>
+<label>Password <input type="password" name="password" required></label>
+<label>Authenticator code <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code"></label>
+<label>Recovery code <input type="text" name="recovery_code" autocomplete="off"></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+type loginPage struct {
+	Request dto.AuthorizeRequestDto
+	Email   string
+	Error   string
+}
+
+type OIDCHandler struct {
+	service *service.OIDCService
+}
+
+func NewOIDCHandler(service *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		service: service,
+	}
+}
+
+func (h *OIDCHandler) Discovery(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.service.Discovery())
+}
+
+// AuthorizeForm validates the authorization request and renders the login
+// form that posts back to Authorize.
+func (h *OIDCHandler) AuthorizeForm(ctx *gin.Context) {
+	var data dto.AuthorizeRequestDto
+	if err := ctx.ShouldBindQuery(&data); err != nil {
+		log.Printf("Error binding authorize data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	if err := h.service.ValidateAuthorizeRequest(&data); err != nil {
+		log.Printf("Error validating authorize request: %v", err)
+		h.authorizeError(ctx, &data, err)
+		return
+	}
+	h.renderLogin(ctx, http.StatusOK, loginPage{Request: data})
+}
+
+func (h *OIDCHandler) Authorize(ctx *gin.Context) {
+	var data dto.AuthorizeDto
+	if err := ctx.ShouldBind(&data); err != nil {
+		log.Printf("Error binding authorize data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	code, err := h.service.Authorize(&data, ctx.ClientIP())
+	if err != nil {
+		log.Printf("Error authorizing: %v", err)
+		page := loginPage{Request: data.AuthorizeRequestDto, Email: data.Email}
+		var lockoutErr *service.LockoutError
+		switch {
+		case errors.As(err, &lockoutErr):
+			page.Error = err.Error()
+			h.renderLogin(ctx, lockoutStatus(ctx, lockoutErr), page)
+		case errors.Is(err, service.ErrSecurityKeyUnsupported):
+			page.Error = "Security keys cannot be used here, enter a recovery code"
+			h.renderLogin(ctx, http.StatusUnauthorized, page)
+		case errors.Is(err, service.ErrMFARequired):
+			page.Error = "Enter your verification code"
+			h.renderLogin(ctx, http.StatusUnauthorized, page)
+		case errors.Is(err, service.ErrEmailNotVerified):
+			page.Error = "Verify your email address before signing in"
+			h.renderLogin(ctx, http.StatusForbidden, page)
+		case errors.Is(err, service.ErrUserNotFound) ||
+			errors.Is(err, service.ErrInvalidPassword) ||
+			errors.Is(err, service.ErrInvalidPasscode) ||
+			errors.Is(err, service.ErrInvalidRecoveryCode):
+			page.Error = "Invalid credentials"
+			h.renderLogin(ctx, http.StatusUnauthorized, page)
+		default:
+			h.authorizeError(ctx, &data.AuthorizeRequestDto, err)
+		}
+		return
+	}
+	ctx.Redirect(http.StatusFound, redirectURL(data.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {data.State},
+	}))
+}
+
+// authorizeError only redirects back to the client once the client and the
+// redirect URI are known to be valid, otherwise the error is shown here.
+func (h *OIDCHandler) authorizeError(ctx *gin.Context, data *dto.AuthorizeRequestDto, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidClient) || errors.Is(err, service.ErrInvalidRedirectURI) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	ctx.Redirect(http.StatusFound, redirectURL(data.RedirectURI, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {err.Error()},
+		"state":             {data.State},
+	}))
+}
+
+func (h *OIDCHandler) renderLogin(ctx *gin.Context, status int, page loginPage) {
+	var body bytes.Buffer
+	if err := loginTemplate.Execute(&body, page); err != nil {
+		log.Printf("Error rendering the login form: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Header("X-Frame-Options", "DENY")
+	ctx.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	ctx.Data(status, "text/html; charset=utf-8", body.Bytes())
+}
+
+func (h *OIDCHandler) Token(ctx *gin.Context) {
+	var data dto.TokenRequestDto
+	if err := ctx.ShouldBind(&data); err != nil {
+		log.Printf("Error binding token data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": service.ErrInvalidOAuthRequest.Code,
+		})
+		return
+	}
+	clientCredentials(ctx, &data.ClientID, &data.ClientSecret)
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+	tokens, err := h.service.Exchange(&data)
+	if err != nil {
+		log.Printf("Error exchanging token: %v", err)
+		oauthError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *OIDCHandler) Introspect(ctx *gin.Context) {
+	var data dto.IntrospectDto
+	if err := ctx.ShouldBind(&data); err != nil {
+		log.Printf("Error binding introspect data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": service.ErrInvalidOAuthRequest.Code,
+		})
+		return
+	}
+	clientCredentials(ctx, &data.ClientID, &data.ClientSecret)
+	ctx.Header("Cache-Control", "no-store")
+	result, err := h.service.Introspect(&data)
+	if err != nil {
+		log.Printf("Error introspecting token: %v", err)
+		oauthError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (h *OIDCHandler) Revoke(ctx *gin.Context) {
+	var data dto.RevokeTokenDto
+	if err := ctx.ShouldBind(&data); err != nil {
+		log.Printf("Error binding revoke data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": service.ErrInvalidOAuthRequest.Code,
+		})
+		return
+	}
+	clientCredentials(ctx, &data.ClientID, &data.ClientSecret)
+	if err := h.service.Revoke(&data); err != nil {
+		log.Printf("Error revoking token: %v", err)
+		oauthError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// clientCredentials prefers HTTP basic authentication over the client_id
+// and client_secret form parameters.
+func clientCredentials(ctx *gin.Context, clientID, clientSecret *string) {
+	if id, secret, ok := ctx.Request.BasicAuth(); ok {
+		*clientID, *clientSecret = id, secret
+	}
+}
+
+// oauthError writes the error response of RFC 6749 section 5.2.
+func oauthError(ctx *gin.Context, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": "server_error",
+		})
+		return
+	}
+	status := http.StatusBadRequest
+	if errors.Is(err, service.ErrInvalidClient) {
+		status = http.StatusUnauthorized
+		ctx.Header("WWW-Authenticate", `Basic realm="otp-api"`)
+	}
+	ctx.JSON(status, gin.H{
+		"error":             oauthErr.Code,
+		"error_description": err.Error(),
+	})
+}
+
+func (h *OIDCHandler) UserInfo(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	claims := ctx.MustGet("claims").(*model.Claims)
+	info, err := h.service.UserInfo(userID, claims.OAuthScope)
+	if err != nil {
+		log.Printf("Error getting user info: %v", err)
+		if errors.Is(err, service.ErrUserNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, info)
+}
+
+func redirectURL(base string, params url.Values) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
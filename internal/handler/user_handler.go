@@ -1,20 +1,24 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
 	"github.com/SantiagoBedoya/otp-api/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
 type UserHandler struct {
 	service *service.UserService
+	auth    *service.AuthService
 }
 
-func NewUserHandler(service *service.UserService) *UserHandler {
+func NewUserHandler(service *service.UserService, auth *service.AuthService) *UserHandler {
 	return &UserHandler{
 		service: service,
+		auth:    auth,
 	}
 }
 
@@ -29,3 +33,74 @@ func (h *UserHandler) GetUsers(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, users)
 }
+
+func (h *UserHandler) ChangePassword(ctx *gin.Context) {
+	var data dto.ChangePasswordDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding change password data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.auth.ChangePassword(userID, &data, ctx.ClientIP()); err != nil {
+		log.Printf("Error changing password: %v", err)
+		if passwordError(ctx, err) {
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *UserHandler) ChangeEmail(ctx *gin.Context) {
+	var data dto.ChangeEmailDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding change email data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.auth.ChangeEmail(userID, &data, ctx.ClientIP()); err != nil {
+		log.Printf("Error changing email: %v", err)
+		if errors.Is(err, service.ErrInvalidEmail) || errors.Is(err, service.ErrEmailInUse) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (h *UserHandler) ConfirmEmailChange(ctx *gin.Context) {
+	var data dto.VerifyEmailDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding confirm email data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.auth.ConfirmEmailChange(userID, &data); err != nil {
+		log.Printf("Error confirming email change: %v", err)
+		if errors.Is(err, service.ErrInvalidVerificationToken) || errors.Is(err, service.ErrEmailInUse) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type WebAuthnHandler struct {
+	service *service.WebAuthnService
+}
+
+func NewWebAuthnHandler(service *service.WebAuthnService) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		service: service,
+	}
+}
+
+func (h *WebAuthnHandler) BeginRegistration(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	options, err := h.service.BeginRegistration(userID)
+	if err != nil {
+		log.Printf("Error starting WebAuthn registration: %v", err)
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, options)
+}
+
+func (h *WebAuthnHandler) FinishRegistration(ctx *gin.Context) {
+	var data dto.PublicKeyCredentialDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding WebAuthn credential: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	tokens, err := h.service.FinishRegistration(userID, &data)
+	if err != nil {
+		log.Printf("Error finishing WebAuthn registration: %v", err)
+		if errors.Is(err, service.ErrCredentialInUse) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		h.ceremonyError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *WebAuthnHandler) BeginLogin(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	options, err := h.service.BeginLogin(userID)
+	if err != nil {
+		log.Printf("Error starting WebAuthn login: %v", err)
+		if errors.Is(err, service.ErrNoWebAuthnCredentials) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, options)
+}
+
+func (h *WebAuthnHandler) FinishLogin(ctx *gin.Context) {
+	var data dto.PublicKeyCredentialDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding WebAuthn credential: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	tokens, err := h.service.FinishLogin(userID, &data)
+	if err != nil {
+		log.Printf("Error finishing WebAuthn login: %v", err)
+		h.ceremonyError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *WebAuthnHandler) BeginPasskeyLogin(ctx *gin.Context) {
+	options, err := h.service.BeginPasskeyLogin()
+	if err != nil {
+		log.Printf("Error starting passkey login: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, options)
+}
+
+func (h *WebAuthnHandler) FinishPasskeyLogin(ctx *gin.Context) {
+	var data dto.PublicKeyCredentialDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding WebAuthn credential: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	tokens, err := h.service.FinishPasskeyLogin(&data)
+	if err != nil {
+		log.Printf("Error finishing passkey login: %v", err)
+		h.ceremonyError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *WebAuthnHandler) ListCredentials(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	creds, err := h.service.ListCredentials(userID)
+	if err != nil {
+		log.Printf("Error listing WebAuthn credentials: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, creds)
+}
+
+func (h *WebAuthnHandler) DeleteCredential(ctx *gin.Context) {
+	id, ok := factorID(ctx)
+	if !ok {
+		return
+	}
+	var data dto.VerifyIdentityDto
+	if err := ctx.ShouldBindJSON(&data); err != nil {
+		log.Printf("Error binding delete credential data: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid data",
+		})
+		return
+	}
+	userID := ctx.GetString("userID")
+	if err := h.service.DeleteCredential(userID, id, &data, ctx.ClientIP()); err != nil {
+		log.Printf("Error deleting WebAuthn credential: %v", err)
+		if errors.Is(err, service.ErrFactorNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		identityError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *WebAuthnHandler) ceremonyError(ctx *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidCredential) || errors.Is(err, service.ErrInvalidWebAuthnChallenge) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{
+		"message": "Something went wrong",
+	})
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
+	"github.com/gin-gonic/gin"
+)
+
+type WellKnownHandler struct {
+	keys *signing.KeySet
+}
+
+func NewWellKnownHandler(keys *signing.KeySet) *WellKnownHandler {
+	return &WellKnownHandler{
+		keys: keys,
+	}
+}
+
+// JWKS publishes the keys that verify access tokens, including the ones
+// kept after a rotation, so clients can refresh their cache by kid.
+func (h *WellKnownHandler) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.keys.JWKS())
+}
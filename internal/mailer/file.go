@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer writes every message as an .eml file in dir instead of
+// sending it.
+func NewFileMailer(dir, from string) service.Mailer {
+	return &fileMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (m *fileMailer) Send(msg *model.MailMessage) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), filepath.Base(filepath.Clean("/"+msg.To)))
+	return os.WriteFile(filepath.Join(m.dir, name), formatMessage(m.from, msg), 0o600)
+}
@@ -0,0 +1,22 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+// New returns the mailer selected by cfg.Driver.
+func New(cfg config.Mail) (service.Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From), nil
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
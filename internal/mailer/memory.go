@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"sync"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+// MemoryMailer keeps sent messages so tests can read them back.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []model.MailMessage
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(msg *model.MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+func (m *MemoryMailer) Messages() []model.MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.MailMessage(nil), m.messages...)
+}
+
+// Last returns the last message sent, or nil.
+func (m *MemoryMailer) Last() *model.MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		return nil
+	}
+	msg := m.messages[len(m.messages)-1]
+	return &msg
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+type smtpMailer struct {
+	cfg config.Mail
+}
+
+func NewSMTPMailer(cfg config.Mail) service.Mailer {
+	return &smtpMailer{
+		cfg: cfg,
+	}
+}
+
+// Send uses STARTTLS when the server offers it, net/smtp refuses to send
+// credentials over an unencrypted connection to a remote host.
+func (m *smtpMailer) Send(msg *model.MailMessage) error {
+	addr := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+	var auth smtp.Auth
+	if m.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+	}
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{msg.To}, formatMessage(m.cfg.From, msg))
+}
+
+var headerReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+func formatMessage(from string, msg *model.MailMessage) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerReplacer.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerReplacer.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerReplacer.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -1,16 +1,49 @@
 package middleware
 
 import (
+	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(ctx *gin.Context) {
+type Auth struct {
+	revocations *service.RevocationService
+	keys        *signing.KeySet
+}
+
+func NewAuth(revocations *service.RevocationService, keys *signing.KeySet) *Auth {
+	return &Auth{
+		revocations: revocations,
+		keys:        keys,
+	}
+}
+
+// RequireAccess only accepts fully authenticated first-party access tokens.
+// Tokens issued to an OAuth client never reach the account routes.
+func (a *Auth) RequireAccess(ctx *gin.Context) {
+	a.authenticate(ctx, false, model.ScopeAccess)
+}
+
+// RequireMFAPending also accepts the short-lived token issued by sign-in
+// while the second factor is still pending.
+func (a *Auth) RequireMFAPending(ctx *gin.Context) {
+	a.authenticate(ctx, false, model.ScopeAccess, model.ScopeMFAPending)
+}
+
+// RequireClientAccess only accepts access tokens issued to an OAuth client.
+func (a *Auth) RequireClientAccess(ctx *gin.Context) {
+	a.authenticate(ctx, true, model.ScopeAccess)
+}
+
+func (a *Auth) authenticate(ctx *gin.Context, client bool, scopes ...string) {
 	bearerToken := ctx.GetHeader("authorization")
 	if bearerToken == "" {
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
@@ -19,15 +52,14 @@ func AuthMiddleware(ctx *gin.Context) {
 		return
 	}
 	parts := strings.Split(bearerToken, " ")
-	if strings.ToLower(parts[0]) != "bearer" {
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"message": "Invalid bearer token",
 		})
 		return
 	}
-	token, err := jwt.Parse(parts[1], func(t *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	var claims model.Claims
+	token, err := jwt.ParseWithClaims(parts[1], &claims, a.keys.Keyfunc, jwt.WithValidMethods(a.keys.Methods()))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"message": "Invalid bearer token",
@@ -40,7 +72,27 @@ func AuthMiddleware(ctx *gin.Context) {
 		})
 		return
 	}
-	userId, err := token.Claims.GetSubject()
+	if !hasScope(claims.Scope, scopes) || (claims.ClientID != "") != client {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"message": "Invalid bearer token",
+		})
+		return
+	}
+	revoked, err := a.revocations.IsRevoked(&claims)
+	if err != nil {
+		log.Printf("Error checking token revocation: %v", err)
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"message": "Something went wrong",
+		})
+		return
+	}
+	if revoked {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"message": "Token has been revoked",
+		})
+		return
+	}
+	userId, err := claims.GetSubject()
 	if err != nil {
 		log.Printf("Error getting the subject: %v", err)
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
@@ -50,5 +102,71 @@ func AuthMiddleware(ctx *gin.Context) {
 	}
 
 	ctx.Set("userID", userId)
+	ctx.Set("claims", &claims)
 	ctx.Next()
 }
+
+func hasScope(scope string, scopes []string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAMR must run after RequireAccess. It rejects tokens that were not
+// issued after every one of the given authentication methods, e.g.
+// RequireAMR(model.AMRMFA) to demand a second factor.
+func (a *Auth) RequireAMR(methods ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := requestClaims(ctx)
+		if !ok {
+			return
+		}
+		for _, method := range methods {
+			if !model.HasAMR(claims.AMR, method) {
+				insufficientAuthentication(ctx, fmt.Sprintf(`acr_values="%s"`, model.ACRMFA))
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
+
+// RequireFreshAuth must run after RequireAccess. It rejects tokens whose
+// user signed in more than maxAge ago, so sensitive routes can ask for a
+// step-up re-authentication even while the access token is still valid.
+func (a *Auth) RequireFreshAuth(maxAge time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := requestClaims(ctx)
+		if !ok {
+			return
+		}
+		if claims.AuthTime == nil || time.Since(claims.AuthTime.Time) > maxAge {
+			insufficientAuthentication(ctx, fmt.Sprintf(`max_age="%d"`, int(maxAge.Seconds())))
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func requestClaims(ctx *gin.Context) (*model.Claims, bool) {
+	value, ok := ctx.Get("claims")
+	claims, _ := value.(*model.Claims)
+	if !ok || claims == nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"message": "Bearer token is required",
+		})
+		return nil, false
+	}
+	return claims, true
+}
+
+// insufficientAuthentication answers with the step-up challenge of RFC 9470.
+func insufficientAuthentication(ctx *gin.Context, param string) {
+	ctx.Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication", `+param)
+	ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"message": "A stronger or more recent authentication is required",
+	})
+}
@@ -0,0 +1,121 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/middleware"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/memory"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var keys = signing.NewHMACKeySet([]byte("secret"))
+
+func newRouter(handlers ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handlers = append(handlers, func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+	router.GET("/", handlers...)
+	return router
+}
+
+func token(t *testing.T, amr []string, authTime time.Time) string {
+	t.Helper()
+	return clientToken(t, "", amr, authTime)
+}
+
+// clientToken signs an access token issued to the OAuth client clientID.
+func clientToken(t *testing.T, clientID string, amr []string, authTime time.Time) string {
+	t.Helper()
+	now := time.Now()
+	signed, err := keys.Sign(model.Claims{
+		Scope:      model.ScopeAccess,
+		ClientID:   clientID,
+		OAuthScope: "openid",
+		AMR:        amr,
+		AuthTime:   jwt.NewNumericDate(authTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			Subject:   "1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return signed
+}
+
+func do(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireAMR(t *testing.T) {
+	auth := middleware.NewAuth(service.NewRevocationService(memory.NewRevocationRepository()), keys)
+	router := newRouter(auth.RequireAccess, auth.RequireAMR(model.AMRMFA))
+
+	w := do(router, token(t, []string{model.AMRPassword}, time.Now()))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d for a password only token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if !strings.Contains(w.Header().Get("WWW-Authenticate"), "insufficient_user_authentication") {
+		t.Errorf("expected a step-up challenge, got %q", w.Header().Get("WWW-Authenticate"))
+	}
+
+	w = do(router, token(t, []string{model.AMRPassword, model.AMROTP, model.AMRMFA}, time.Now()))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected %d after MFA, got %d", http.StatusNoContent, w.Code)
+	}
+}
+
+func TestRequireFreshAuth(t *testing.T) {
+	auth := middleware.NewAuth(service.NewRevocationService(memory.NewRevocationRepository()), keys)
+	router := newRouter(auth.RequireAccess, auth.RequireFreshAuth(5*time.Minute))
+
+	w := do(router, token(t, []string{model.AMRPassword}, time.Now().Add(-time.Hour)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d for a stale authentication, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if !strings.Contains(w.Header().Get("WWW-Authenticate"), `max_age="300"`) {
+		t.Errorf("expected max_age in the challenge, got %q", w.Header().Get("WWW-Authenticate"))
+	}
+
+	w = do(router, token(t, []string{model.AMRPassword}, time.Now()))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected %d for a fresh authentication, got %d", http.StatusNoContent, w.Code)
+	}
+}
+
+func TestClientTokens(t *testing.T) {
+	auth := middleware.NewAuth(service.NewRevocationService(memory.NewRevocationRepository()), keys)
+	mfa := []string{model.AMRPassword, model.AMROTP, model.AMRMFA}
+
+	w := do(newRouter(auth.RequireAccess), clientToken(t, "client-1", mfa, time.Now()))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d for a token issued to an OAuth client, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	router := newRouter(auth.RequireClientAccess)
+	w = do(router, token(t, mfa, time.Now()))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d for a first-party token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	w = do(router, clientToken(t, "client-1", mfa, time.Now()))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected %d for a client token, got %d", http.StatusNoContent, w.Code)
+	}
+}
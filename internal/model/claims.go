@@ -0,0 +1,80 @@
+package model
+
+import "github.com/golang-jwt/jwt/v5"
+
+const (
+	ScopeAccess     = "access"
+	ScopeMFAPending = "mfa_pending"
+	// ScopeTrustedDevice tokens are only accepted by sign in, to skip the
+	// second factor on a remembered device.
+	ScopeTrustedDevice = "trusted_device"
+	// ScopeVerifyEmail tokens are mailed to confirm an address,
+	// ScopeChangeEmail tokens to confirm the new address of a user.
+	ScopeVerifyEmail = "verify_email"
+	ScopeChangeEmail = "change_email"
+)
+
+// Authentication method references from RFC 8176, plus recovery for the
+// single use codes handed out when 2FA is enabled and device for sign ins
+// from a trusted device.
+const (
+	AMRPassword      = "pwd"
+	AMROTP           = "otp"
+	AMRHardwareKey   = "hwk"
+	AMRRecovery      = "recovery"
+	AMRTrustedDevice = "device"
+	AMRMFA           = "mfa"
+)
+
+// Authentication context class references, ACRMFA is used once a second
+// factor has been verified.
+const (
+	ACRPassword = "1"
+	ACRMFA      = "2"
+)
+
+// Claims of the tokens this API issues. Scope is the kind of token, e.g.
+// ScopeAccess. Access tokens issued to an OAuth client carry its ID and
+// the OAuth scope the user granted it in OAuthScope.
+type Claims struct {
+	Scope      string           `json:"scope,omitempty"`
+	ClientID   string           `json:"client_id,omitempty"`
+	OAuthScope string           `json:"oauth_scope,omitempty"`
+	SessionID  string           `json:"sid,omitempty"`
+	AMR        []string         `json:"amr,omitempty"`
+	ACR        string           `json:"acr,omitempty"`
+	AuthTime   *jwt.NumericDate `json:"auth_time,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func HasAMR(amr []string, method string) bool {
+	for _, m := range amr {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+type IDTokenClaims struct {
+	Nonce      string           `json:"nonce,omitempty"`
+	AuthTime   *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR        []string         `json:"amr,omitempty"`
+	ACR        string           `json:"acr,omitempty"`
+	Email      string           `json:"email,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	GivenName  string           `json:"given_name,omitempty"`
+	FamilyName string           `json:"family_name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// EmailVerificationClaims are carried by the link that confirms Email
+// belongs to the user in the subject. Changing the address invalidates
+// links sent to the old one. Links for an email change also carry the
+// address being replaced, PreviousEmail.
+type EmailVerificationClaims struct {
+	Scope         string `json:"scope"`
+	Email         string `json:"email"`
+	PreviousEmail string `json:"previous_email,omitempty"`
+	jwt.RegisteredClaims
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+const (
+	// OTPEnroll codes confirm the address or phone before it becomes the
+	// second factor, OTPVerify codes are used once it is.
+	OTPEnroll = "enroll"
+	OTPVerify = "verify"
+)
+
+// DeliveredCode holds what the codes sent by email and by SMS have in
+// common.
+type DeliveredCode struct {
+	ID        int64
+	UserID    int64
+	CodeHash  string
+	Purpose   string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// Delivered returns the common fields of an EmailOTP or SMSOTP.
+func (c *DeliveredCode) Delivered() *DeliveredCode {
+	return c
+}
+
+type EmailOTP struct {
+	DeliveredCode
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Factor is an authenticator app (MFAMethodTOTP) or an HOTP fob
+// (MFAMethodHOTP) of a user. A pending factor becomes active once a code
+// generated from it is validated.
+type Factor struct {
+	ID     int64
+	UserID int64
+	Type   string
+	Name   string
+	Secret string
+	Params TOTPParams
+	// Counter is the next HOTP counter value the fob will use.
+	Counter uint64
+	// LastOTPAt is the start of the last accepted TOTP time-step.
+	LastOTPAt  int64
+	Active     bool
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
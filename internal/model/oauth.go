@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+type OAuthClient struct {
+	ID           string
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+}
+
+// IsPublic reports whether the client cannot keep a secret, like a SPA or a
+// mobile app. Those rely on PKCE alone.
+func (c *OAuthClient) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+type AuthorizationCode struct {
+	ID            int64
+	CodeHash      string
+	ClientID      string
+	UserID        int64
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	AMR           []string
+	FamilyID      string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+}
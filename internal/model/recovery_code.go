@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+type RecoveryCode struct {
+	ID       int64
+	UserID   int64
+	CodeHash string
+	UsedAt   *time.Time
+}
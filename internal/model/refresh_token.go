@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// RefreshToken is one token of a family rotated from the same sign in.
+// ClientID is the OAuth client the family was issued to, empty for
+// first-party sign ins, and Scope the OAuth scope the user granted it.
+type RefreshToken struct {
+	ID        int64
+	UserID    int64
+	FamilyID  string
+	ClientID  string
+	Scope     string
+	TokenHash string
+	AMR       []string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
@@ -0,0 +1,13 @@
+package model
+
+type SMSMessage struct {
+	To   string `json:"to"`
+	Body string `json:"body"`
+}
+
+// SMSOTP is a code texted to Phone. Enrollment codes carry the number
+// being verified, it is only stored on the user once the code is used.
+type SMSOTP struct {
+	DeliveredCode
+	Phone string
+}
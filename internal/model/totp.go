@@ -0,0 +1,7 @@
+package model
+
+type TOTPParams struct {
+	Algorithm string
+	Digits    int
+	Period    uint
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// TrustedDevice is a browser or app the user chose to remember after
+// passing 2FA. Only the hash of its device token is stored.
+type TrustedDevice struct {
+	ID         int64
+	UserID     int64
+	TokenHash  string
+	Name       string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+}
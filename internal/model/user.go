@@ -1,11 +1,25 @@
 package model
 
+import "time"
+
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodEmail    = "email"
+	MFAMethodSMS      = "sms"
+	MFAMethodWebAuthn = "webauthn"
+	MFAMethodHOTP     = "hotp"
+)
+
 type User struct {
-	ID        int64  `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	Password  string `json:"password,omitempty"`
-	Secret2FA string `json:"secret_2fa,omitempty"`
-	Valid2FA  bool   `json:"valid_2fa,omitempty"`
+	ID                      int64      `json:"id"`
+	FirstName               string     `json:"first_name"`
+	LastName                string     `json:"last_name"`
+	Email                   string     `json:"email"`
+	EmailVerifiedAt         *time.Time `json:"email_verified_at,omitempty"`
+	EmailVerificationSentAt *time.Time `json:"-"`
+	Password                string     `json:"password,omitempty"`
+	Valid2FA                bool       `json:"valid_2fa,omitempty"`
+	MFAMethod               string     `json:"mfa_method,omitempty"`
+	Phone                   string     `json:"phone,omitempty"`
+	PhoneVerified           bool       `json:"phone_verified,omitempty"`
 }
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// WebAuthn ceremonies a challenge can be used for. WebAuthnPasskey
+// challenges sign in without a password, so they have no user.
+const (
+	WebAuthnRegister = "register"
+	WebAuthnLogin    = "login"
+	WebAuthnPasskey  = "passkey"
+)
+
+type WebAuthnCredential struct {
+	ID           int64
+	UserID       int64
+	Name         string
+	CredentialID []byte
+	// PublicKey is the COSE_Key handed out by the authenticator.
+	PublicKey  []byte
+	SignCount  uint32
+	Transports []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type WebAuthnChallenge struct {
+	ID            int64
+	UserID        int64
+	ChallengeHash string
+	Ceremony      string
+	ExpiresAt     time.Time
+}
@@ -0,0 +1,97 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type Argon2idParams struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+type Argon2id struct {
+	params Argon2idParams
+}
+
+func NewArgon2id(params Argon2idParams) (*Argon2id, error) {
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, errors.New("argon2id iterations and parallelism must be at least 1")
+	}
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return nil, fmt.Errorf("argon2id memory must be at least %d KiB", 8*uint32(params.Parallelism))
+	}
+	return &Argon2id{params: params}, nil
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := a.params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) Compare(hash, password string) error {
+	return compare(hash, password)
+}
+
+// NeedsRehash reports bcrypt hashes and argon2id hashes using less memory
+// or fewer iterations than a.
+func (a *Argon2id) NeedsRehash(hash string) bool {
+	if !isArgon2id(hash) {
+		return true
+	}
+	p, _, _, err := parseArgon2id(hash)
+	return err != nil || p.Memory < a.params.Memory || p.Iterations < a.params.Iterations
+}
+
+func compareArgon2id(hash, password string) error {
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func parseArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var p Argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	// argon2.IDKey panics on no iterations or threads.
+	if err != nil || p.Iterations < 1 || p.Parallelism < 1 {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	return p, salt, key, nil
+}
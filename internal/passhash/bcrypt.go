@@ -0,0 +1,49 @@
+package passhash
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) (*Bcrypt, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &Bcrypt{cost: cost}, nil
+}
+
+func (b *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *Bcrypt) Compare(hash, password string) error {
+	return compare(hash, password)
+}
+
+// NeedsRehash reports bcrypt hashes of a lower cost. Argon2id hashes are
+// stronger and kept as they are.
+func (b *Bcrypt) NeedsRehash(hash string) bool {
+	if isArgon2id(hash) {
+		return false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < b.cost
+}
+
+func compareBcrypt(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	return err
+}
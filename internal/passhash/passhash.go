@@ -0,0 +1,56 @@
+// Package passhash hashes passwords with bcrypt or argon2id. Argon2id
+// hashes are PHC strings, e.g. "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>",
+// bcrypt hashes keep their own "$2a$<cost>$..." format. Every hasher
+// compares passwords against hashes of both algorithms, so stored hashes
+// keep working when the algorithm changes.
+package passhash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+var (
+	ErrMismatch      = errors.New("password does not match the hash")
+	ErrUnknownFormat = errors.New("password hash format is not supported")
+)
+
+// New returns the hasher selected by cfg.Algorithm.
+func New(cfg config.PasswordHash) (service.PasswordHasher, error) {
+	switch cfg.Algorithm {
+	case config.PasswordHashBcrypt:
+		return NewBcrypt(cfg.BcryptCost)
+	case config.PasswordHashArgon2id:
+		return NewArgon2id(Argon2idParams{
+			Memory:      uint32(cfg.Argon2Memory),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+		})
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.Algorithm)
+	}
+}
+
+// compare checks password against a hash of any supported algorithm.
+func compare(hash, password string) error {
+	switch {
+	case isArgon2id(hash):
+		return compareArgon2id(hash, password)
+	case isBcrypt(hash):
+		return compareBcrypt(hash, password)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+func isArgon2id(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
@@ -0,0 +1,99 @@
+package passhash_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/passhash"
+)
+
+func TestHashAndCompare(t *testing.T) {
+	bcryptHasher, err := passhash.NewBcrypt(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHasher, err := passhash.NewArgon2id(passhash.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcryptHash, err := bcryptHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	argonHash, err := argonHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("expected a PHC string, got %q", argonHash)
+	}
+
+	// Either hasher compares hashes of both algorithms.
+	for _, hasher := range []interface {
+		Compare(hash, password string) error
+	}{bcryptHasher, argonHasher} {
+		for _, hash := range []string{bcryptHash, argonHash} {
+			if err := hasher.Compare(hash, "correct horse"); err != nil {
+				t.Errorf("Unexpected error comparing %q: %v", hash, err)
+			}
+			if err := hasher.Compare(hash, "wrong horse"); !errors.Is(err, passhash.ErrMismatch) {
+				t.Errorf("expected error: %v, got %v", passhash.ErrMismatch, err)
+			}
+		}
+		for _, hash := range []string{"plain", "$argon2id$v=19$m=64,t=1,p=0$c2FsdA$a2V5"} {
+			if err := hasher.Compare(hash, "correct horse"); !errors.Is(err, passhash.ErrUnknownFormat) {
+				t.Errorf("expected error: %v, got %v", passhash.ErrUnknownFormat, err)
+			}
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weakBcrypt, _ := passhash.NewBcrypt(4)
+	strongBcrypt, _ := passhash.NewBcrypt(5)
+	weakArgon, _ := passhash.NewArgon2id(passhash.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1})
+	strongArgon, _ := passhash.NewArgon2id(passhash.Argon2idParams{Memory: 128, Iterations: 1, Parallelism: 1})
+
+	weakBcryptHash, _ := weakBcrypt.Hash("correct horse")
+	weakArgonHash, _ := weakArgon.Hash("correct horse")
+	strongArgonHash, _ := strongArgon.Hash("correct horse")
+
+	tests := []struct {
+		name   string
+		hasher interface{ NeedsRehash(hash string) bool }
+		hash   string
+		want   bool
+	}{
+		{"same bcrypt cost", weakBcrypt, weakBcryptHash, false},
+		{"higher bcrypt cost", strongBcrypt, weakBcryptHash, true},
+		{"argon2id is not downgraded", strongBcrypt, weakArgonHash, false},
+		{"bcrypt to argon2id", weakArgon, weakBcryptHash, true},
+		{"same argon2id parameters", weakArgon, weakArgonHash, false},
+		{"more argon2id memory", strongArgon, weakArgonHash, true},
+		{"less argon2id memory", weakArgon, strongArgonHash, false},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+			t.Errorf("%s: NeedsRehash = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	cfg := config.DefaultPasswordHash()
+	if _, err := passhash.New(cfg); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	cfg.Algorithm = config.PasswordHashBcrypt
+	cfg.BcryptCost = 40
+	if _, err := passhash.New(cfg); err == nil {
+		t.Error("expected an error for an out of range bcrypt cost")
+	}
+	cfg.Algorithm = "md5"
+	if _, err := passhash.New(cfg); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
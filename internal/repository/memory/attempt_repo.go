@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+type attemptRepo struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+}
+
+func NewAttemptRepository() service.AttemptRepository {
+	return &attemptRepo{
+		attempts: make(map[string]model.LoginAttempt),
+	}
+}
+
+func (r *attemptRepo) Update(key string, update func(attempt *model.LoginAttempt)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key}
+	}
+	update(&attempt)
+	r.attempts[key] = attempt
+	return nil
+}
+
+func (r *attemptRepo) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
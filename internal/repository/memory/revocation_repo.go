@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+type revocationRepo struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+}
+
+func NewRevocationRepository() service.RevocationRepository {
+	return &revocationRepo{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+func (r *revocationRepo) Revoke(jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for k, exp := range r.tokens {
+		if now.After(exp) {
+			delete(r.tokens, k)
+		}
+	}
+	r.tokens[jti] = expiresAt
+	return nil
+}
+
+func (r *revocationRepo) IsRevoked(jti string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.tokens[jti]
+	return ok, nil
+}
+
+func (r *revocationRepo) RevokeAllForUser(userID string, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users[userID] = before
+	return nil
+}
+
+func (r *revocationRepo) GetRevokedBefore(userID string) (time.Time, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.users[userID], nil
+}
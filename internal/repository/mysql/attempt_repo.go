@@ -0,0 +1,72 @@
+package mysql
+
+import (
+	"database/sql"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	// The upsert creates the row or takes its lock when it exists, so the
+	// select below never waits on a shared lock another request also holds.
+	CreateLoginAttemptQuery = "INSERT INTO login_attempts (attempt_key) VALUES (?) ON DUPLICATE KEY UPDATE attempt_key = attempt_key"
+	GetLoginAttemptQuery    = "SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE attempt_key = ? FOR UPDATE"
+	UpdateLoginAttemptQuery = "UPDATE login_attempts SET failures = ?, last_failure_at = ?, locked_until = ? WHERE attempt_key = ?"
+	DeleteLoginAttemptQuery = "DELETE FROM login_attempts WHERE attempt_key = ?"
+)
+
+type attemptRepo struct {
+	db *sql.DB
+}
+
+func NewAttemptRepository(db *sql.DB) service.AttemptRepository {
+	return &attemptRepo{
+		db: db,
+	}
+}
+
+// Update holds the row lock from the upsert until commit, so parallel
+// updates of the same key see each other's result.
+func (r *attemptRepo) Update(key string, update func(attempt *model.LoginAttempt)) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(CreateLoginAttemptQuery, key); err != nil {
+		return err
+	}
+	var (
+		lastFailureAt sql.NullTime
+		lockedUntil   sql.NullTime
+	)
+	attempt := model.LoginAttempt{Key: key}
+	err = tx.QueryRow(GetLoginAttemptQuery, key).Scan(&attempt.Failures, &lastFailureAt, &lockedUntil)
+	if err != nil {
+		return err
+	}
+	attempt.LastFailureAt = lastFailureAt.Time
+	attempt.LockedUntil = lockedUntil.Time
+	update(&attempt)
+	_, err = tx.Exec(UpdateLoginAttemptQuery, attempt.Failures, nullTime(attempt.LastFailureAt), nullTime(attempt.LockedUntil), key)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *attemptRepo) Delete(key string) error {
+	stmt, err := r.db.Prepare(DeleteLoginAttemptQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
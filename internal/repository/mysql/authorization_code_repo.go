@@ -0,0 +1,98 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	SaveAuthorizationCodeQuery      = "INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, amr, auth_time, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	GetAuthorizationCodeByHashQuery = "SELECT id, code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, amr, family_id, auth_time, expires_at, used_at FROM oauth_authorization_codes WHERE code_hash = ?"
+	MarkAuthorizationCodeUsedQuery  = "UPDATE oauth_authorization_codes SET used_at = ?, family_id = ? WHERE id = ? AND used_at IS NULL"
+)
+
+type authorizationCodeRepo struct {
+	db *sql.DB
+}
+
+func NewAuthorizationCodeRepository(db *sql.DB) service.AuthorizationCodeRepository {
+	return &authorizationCodeRepo{
+		db: db,
+	}
+}
+
+func (r *authorizationCodeRepo) Save(c *model.AuthorizationCode) error {
+	stmt, err := r.db.Prepare(SaveAuthorizationCodeQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(c.CodeHash, c.ClientID, c.UserID, c.RedirectURI, c.Scope, c.Nonce, c.CodeChallenge, strings.Join(c.AMR, " "), c.AuthTime, c.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = lastID
+	return nil
+}
+
+func (r *authorizationCodeRepo) GetByHash(hash string) (*model.AuthorizationCode, error) {
+	stmt, err := r.db.Prepare(GetAuthorizationCodeByHashQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var (
+		code     model.AuthorizationCode
+		amr      string
+		familyID sql.NullString
+		usedAt   sql.NullTime
+	)
+	err = stmt.QueryRow(hash).Scan(&code.ID, &code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope,
+		&code.Nonce, &code.CodeChallenge, &amr, &familyID, &code.AuthTime, &code.ExpiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidGrant
+		}
+		return nil, err
+	}
+	code.AMR = strings.Fields(amr)
+	code.FamilyID = familyID.String
+	if usedAt.Valid {
+		code.UsedAt = &usedAt.Time
+	}
+	return &code, nil
+}
+
+// MarkUsed records the token family issued for the code so a replay can
+// revoke it.
+func (r *authorizationCodeRepo) MarkUsed(id int64, familyID string) error {
+	stmt, err := r.db.Prepare(MarkAuthorizationCodeUsedQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(time.Now(), familyID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrInvalidGrant
+	}
+	return nil
+}
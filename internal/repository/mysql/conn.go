@@ -4,11 +4,17 @@ import (
 	"database/sql"
 	"os"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 func NewMySQLConn() (*sql.DB, error) {
-	db, err := sql.Open("mysql", os.Getenv("MYSQL_CONN"))
+	cfg, err := mysql.ParseDSN(os.Getenv("MYSQL_CONN"))
+	if err != nil {
+		return nil, err
+	}
+	// DATETIME columns are scanned into time.Time.
+	cfg.ParseTime = true
+	db, err := sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	SaveEmailOTPQuery      = "INSERT INTO email_otp_codes (user_id, code_hash, purpose, expires_at, created_at) VALUES (?, ?, ?, ?, ?)"
+	GetLatestEmailOTPQuery = "SELECT id, user_id, code_hash, purpose, expires_at, used_at, created_at FROM email_otp_codes WHERE user_id = ? ORDER BY id DESC LIMIT 1"
+	MarkEmailOTPUsedQuery  = "UPDATE email_otp_codes SET used_at = ? WHERE id = ? AND used_at IS NULL"
+)
+
+type emailOTPRepo struct {
+	db *sql.DB
+}
+
+func NewEmailOTPRepository(db *sql.DB) service.EmailOTPRepository {
+	return &emailOTPRepo{
+		db: db,
+	}
+}
+
+func (r *emailOTPRepo) Save(c *model.EmailOTP) error {
+	stmt, err := r.db.Prepare(SaveEmailOTPQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(c.UserID, c.CodeHash, c.Purpose, c.ExpiresAt, c.CreatedAt)
+	if err != nil {
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = lastID
+	return nil
+}
+
+func (r *emailOTPRepo) GetLatest(userID string) (*model.EmailOTP, error) {
+	stmt, err := r.db.Prepare(GetLatestEmailOTPQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var (
+		code   model.EmailOTP
+		usedAt sql.NullTime
+	)
+	err = stmt.QueryRow(userID).Scan(&code.ID, &code.UserID, &code.CodeHash, &code.Purpose, &code.ExpiresAt, &usedAt, &code.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidPasscode
+		}
+		return nil, err
+	}
+	if usedAt.Valid {
+		code.UsedAt = &usedAt.Time
+	}
+	return &code, nil
+}
+
+func (r *emailOTPRepo) MarkUsed(id int64) error {
+	stmt, err := r.db.Prepare(MarkEmailOTPUsedQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(time.Now(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrPasscodeReused
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/encryption"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	SaveFactorQuery           = "INSERT INTO mfa_factors (user_id, type, name, secret, otp_algorithm, otp_digits, otp_period, counter, active, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	GetUserFactorsQuery       = "SELECT id, user_id, type, name, secret, otp_algorithm, otp_digits, otp_period, counter, last_otp_at, active, created_at, last_used_at FROM mfa_factors WHERE user_id = ? ORDER BY id"
+	ActivateFactorQuery       = "UPDATE mfa_factors SET active = 1 WHERE id = ? AND user_id = ?"
+	RenameFactorQuery         = "UPDATE mfa_factors SET name = ? WHERE id = ? AND user_id = ?"
+	DeleteFactorQuery         = "DELETE FROM mfa_factors WHERE id = ? AND user_id = ?"
+	DeletePendingFactorsQuery = "DELETE FROM mfa_factors WHERE user_id = ? AND active = 0"
+	DeleteUserFactorsQuery    = "DELETE FROM mfa_factors WHERE user_id = ?"
+	SetFactorLastOTPAtQuery   = "UPDATE mfa_factors SET last_otp_at = ?, last_used_at = ? WHERE id = ? AND last_otp_at < ?"
+	SetFactorCounterQuery     = "UPDATE mfa_factors SET counter = ?, last_used_at = ? WHERE id = ? AND counter = ?"
+)
+
+type factorRepo struct {
+	db      *sql.DB
+	keyring *encryption.Keyring
+}
+
+// NewFactorRepository stores factor secrets encrypted with keyring. A nil
+// keyring stores them in plain text.
+func NewFactorRepository(db *sql.DB, keyring *encryption.Keyring) service.FactorRepository {
+	return &factorRepo{
+		db:      db,
+		keyring: keyring,
+	}
+}
+
+func (r *factorRepo) Save(f *model.Factor) error {
+	sealed, err := sealSecret(r.keyring, fmt.Sprint(f.UserID), f.Secret)
+	if err != nil {
+		return err
+	}
+	stmt, err := r.db.Prepare(SaveFactorQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(f.UserID, f.Type, f.Name, sealed, f.Params.Algorithm, f.Params.Digits, f.Params.Period, f.Counter, f.Active, f.CreatedAt)
+	if err != nil {
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	f.ID = lastID
+	return nil
+}
+
+func (r *factorRepo) GetByUserID(userID string) ([]*model.Factor, error) {
+	stmt, err := r.db.Prepare(GetUserFactorsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var factors []*model.Factor
+	for rows.Next() {
+		var (
+			f          model.Factor
+			lastUsedAt sql.NullTime
+		)
+		err := rows.Scan(&f.ID, &f.UserID, &f.Type, &f.Name, &f.Secret,
+			&f.Params.Algorithm, &f.Params.Digits, &f.Params.Period,
+			&f.Counter, &f.LastOTPAt, &f.Active, &f.CreatedAt, &lastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			f.LastUsedAt = &lastUsedAt.Time
+		}
+		f.Secret, err = openSecret(r.keyring, userID, f.Secret)
+		if err != nil {
+			return nil, err
+		}
+		factors = append(factors, &f)
+	}
+	return factors, rows.Err()
+}
+
+func (r *factorRepo) Activate(userID string, id int64) error {
+	stmt, err := r.db.Prepare(ActivateFactorQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *factorRepo) Rename(userID string, id int64, name string) error {
+	stmt, err := r.db.Prepare(RenameFactorQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(name, id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *factorRepo) Delete(userID string, id int64) error {
+	stmt, err := r.db.Prepare(DeleteFactorQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *factorRepo) DeletePending(userID string) error {
+	stmt, err := r.db.Prepare(DeletePendingFactorsQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *factorRepo) DeleteAll(userID string) error {
+	stmt, err := r.db.Prepare(DeleteUserFactorsQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetLastOTPAt only moves the last accepted time-step forward, so two
+// instances accepting the same code at once cannot both succeed.
+func (r *factorRepo) SetLastOTPAt(id int64, stepAt int64) error {
+	stmt, err := r.db.Prepare(SetFactorLastOTPAtQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(stepAt, time.Now(), id, stepAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrPasscodeReused
+	}
+	return nil
+}
+
+// SetCounter only moves the counter from previous, so two instances
+// accepting the same code at once cannot both succeed.
+func (r *factorRepo) SetCounter(id int64, previous, counter uint64) error {
+	stmt, err := r.db.Prepare(SetFactorCounterQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(counter, time.Now(), id, previous)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrPasscodeReused
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	GetOAuthClientQuery  = "SELECT id, name, secret_hash, redirect_uris FROM oauth_clients WHERE id = ?"
+	SaveOAuthClientQuery = "INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris) VALUES (?, ?, ?, ?)"
+)
+
+type oauthClientRepo struct {
+	db *sql.DB
+}
+
+func NewOAuthClientRepository(db *sql.DB) service.OAuthClientRepository {
+	return &oauthClientRepo{
+		db: db,
+	}
+}
+
+func (r *oauthClientRepo) GetByID(clientID string) (*model.OAuthClient, error) {
+	stmt, err := r.db.Prepare(GetOAuthClientQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var (
+		client       model.OAuthClient
+		secretHash   sql.NullString
+		redirectURIs string
+	)
+	err = stmt.QueryRow(clientID).Scan(&client.ID, &client.Name, &secretHash, &redirectURIs)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidClient
+		}
+		return nil, err
+	}
+	client.SecretHash = secretHash.String
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	return &client, nil
+}
+
+// Save stores the redirect URIs space separated, a character they cannot
+// contain unescaped.
+func (r *oauthClientRepo) Save(c *model.OAuthClient) error {
+	stmt, err := r.db.Prepare(SaveOAuthClientQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	secretHash := sql.NullString{String: c.SecretHash, Valid: c.SecretHash != ""}
+	_, err = stmt.Exec(c.ID, c.Name, secretHash, strings.Join(c.RedirectURIs, " "))
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	SavePasswordResetQuery        = "INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)"
+	GetLatestPasswordResetQuery   = "SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM password_reset_tokens WHERE user_id = ? ORDER BY id DESC LIMIT 1"
+	GetPasswordResetByHashQuery   = "SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM password_reset_tokens WHERE token_hash = ?"
+	MarkPasswordResetUsedQuery    = "UPDATE password_reset_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL"
+	InvalidatePasswordResetsQuery = "UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL"
+)
+
+type passwordResetRepo struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) service.PasswordResetRepository {
+	return &passwordResetRepo{
+		db: db,
+	}
+}
+
+func (r *passwordResetRepo) Save(t *model.PasswordResetToken) error {
+	stmt, err := r.db.Prepare(SavePasswordResetQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(t.UserID, t.TokenHash, t.ExpiresAt, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	t.ID = lastID
+	return nil
+}
+
+// GetLatest returns nil when no reset was ever requested for the user.
+func (r *passwordResetRepo) GetLatest(userID string) (*model.PasswordResetToken, error) {
+	stmt, err := r.db.Prepare(GetLatestPasswordResetQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	token, err := scanPasswordReset(stmt.QueryRow(userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *passwordResetRepo) GetByHash(hash string) (*model.PasswordResetToken, error) {
+	stmt, err := r.db.Prepare(GetPasswordResetByHashQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	token, err := scanPasswordReset(stmt.QueryRow(hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidResetToken
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// MarkUsed fails when the token was used concurrently, so a reset link
+// only ever sets one password.
+func (r *passwordResetRepo) MarkUsed(id int64) error {
+	stmt, err := r.db.Prepare(MarkPasswordResetUsedQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(time.Now(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrInvalidResetToken
+	}
+	return nil
+}
+
+// InvalidateAll burns the unused tokens of the user, only the last reset
+// email sent is valid.
+func (r *passwordResetRepo) InvalidateAll(userID string) error {
+	stmt, err := r.db.Prepare(InvalidatePasswordResetsQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanPasswordReset(row rowScanner) (*model.PasswordResetToken, error) {
+	var (
+		token  model.PasswordResetToken
+		usedAt sql.NullTime
+	)
+	err := row.Scan(&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &usedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return &token, nil
+}
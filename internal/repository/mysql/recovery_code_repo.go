@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	DeleteRecoveryCodesQuery    = "DELETE FROM recovery_codes WHERE user_id = ?"
+	SaveRecoveryCodeQuery       = "INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)"
+	GetUnusedRecoveryCodesQuery = "SELECT id, user_id, code_hash FROM recovery_codes WHERE user_id = ? AND used_at IS NULL"
+	MarkRecoveryCodeUsedQuery   = "UPDATE recovery_codes SET used_at = ? WHERE id = ? AND used_at IS NULL"
+)
+
+type recoveryCodeRepo struct {
+	db *sql.DB
+}
+
+func NewRecoveryCodeRepository(db *sql.DB) service.RecoveryCodeRepository {
+	return &recoveryCodeRepo{
+		db: db,
+	}
+}
+
+func (r *recoveryCodeRepo) ReplaceAll(userID string, hashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(DeleteRecoveryCodesQuery, userID); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(SaveRecoveryCodeQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, hash := range hashes {
+		if _, err := stmt.Exec(userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *recoveryCodeRepo) GetUnused(userID string) ([]model.RecoveryCode, error) {
+	stmt, err := r.db.Prepare(GetUnusedRecoveryCodesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := make([]model.RecoveryCode, 0)
+	for rows.Next() {
+		var code model.RecoveryCode
+		if err := rows.Scan(&code.ID, &code.UserID, &code.CodeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+func (r *recoveryCodeRepo) MarkUsed(id int64) error {
+	stmt, err := r.db.Prepare(MarkRecoveryCodeUsedQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(time.Now(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrInvalidRecoveryCode
+	}
+	return nil
+}
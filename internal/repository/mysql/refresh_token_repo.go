@@ -0,0 +1,131 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	SaveRefreshTokenQuery         = "INSERT INTO refresh_tokens (user_id, family_id, token_hash, amr, auth_time, expires_at, client_id, scope) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	GetRefreshTokenByHashQuery    = "SELECT id, user_id, family_id, token_hash, amr, auth_time, expires_at, used_at, revoked_at, client_id, scope FROM refresh_tokens WHERE token_hash = ?"
+	MarkRefreshTokenUsedQuery     = "UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL"
+	RevokeRefreshTokenFamilyQuery = "UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL"
+	RevokeUserRefreshTokensQuery  = "UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL"
+)
+
+type refreshTokenRepo struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) service.RefreshTokenRepository {
+	return &refreshTokenRepo{
+		db: db,
+	}
+}
+
+func (r *refreshTokenRepo) Save(t *model.RefreshToken) error {
+	stmt, err := r.db.Prepare(SaveRefreshTokenQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(t.UserID, t.FamilyID, t.TokenHash, strings.Join(t.AMR, " "), nullTime(t.AuthTime), t.ExpiresAt, nullString(t.ClientID), t.Scope)
+	if err != nil {
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	t.ID = lastID
+	return nil
+}
+
+func (r *refreshTokenRepo) GetByHash(hash string) (*model.RefreshToken, error) {
+	stmt, err := r.db.Prepare(GetRefreshTokenByHashQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var (
+		token     model.RefreshToken
+		amr       string
+		authTime  sql.NullTime
+		usedAt    sql.NullTime
+		revokedAt sql.NullTime
+		clientID  sql.NullString
+	)
+	err = stmt.QueryRow(hash).Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &amr, &authTime, &token.ExpiresAt, &usedAt, &revokedAt, &clientID, &token.Scope)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	token.AMR = strings.Fields(amr)
+	token.AuthTime = authTime.Time
+	token.ClientID = clientID.String
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+func (r *refreshTokenRepo) MarkUsed(id int64) error {
+	stmt, err := r.db.Prepare(MarkRefreshTokenUsedQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(time.Now(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrRefreshTokenReused
+	}
+	return nil
+}
+
+func (r *refreshTokenRepo) RevokeFamily(familyID string) error {
+	stmt, err := r.db.Prepare(RevokeRefreshTokenFamilyQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now(), familyID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *refreshTokenRepo) RevokeAllForUser(userID string) error {
+	stmt, err := r.db.Prepare(RevokeUserRefreshTokensQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
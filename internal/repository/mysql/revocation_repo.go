@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	PurgeRevokedTokensQuery   = "DELETE FROM revoked_tokens WHERE expires_at < ?"
+	RevokeTokenQuery          = "INSERT IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)"
+	IsTokenRevokedQuery       = "SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?"
+	RevokeUserTokensQuery     = "INSERT INTO user_token_revocations (user_id, revoked_before) VALUES (?, ?) ON DUPLICATE KEY UPDATE revoked_before = VALUES(revoked_before)"
+	GetUserRevokedBeforeQuery = "SELECT revoked_before FROM user_token_revocations WHERE user_id = ?"
+)
+
+type revocationRepo struct {
+	db *sql.DB
+}
+
+func NewRevocationRepository(db *sql.DB) service.RevocationRepository {
+	return &revocationRepo{
+		db: db,
+	}
+}
+
+// Revoke purges the expired rows first, an expired token is rejected
+// before it is looked up here.
+func (r *revocationRepo) Revoke(jti string, expiresAt time.Time) error {
+	if err := r.purge(time.Now()); err != nil {
+		return err
+	}
+	stmt, err := r.db.Prepare(RevokeTokenQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(jti, expiresAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revocationRepo) purge(now time.Time) error {
+	stmt, err := r.db.Prepare(PurgeRevokedTokensQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(now)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revocationRepo) IsRevoked(jti string) (bool, error) {
+	stmt, err := r.db.Prepare(IsTokenRevokedQuery)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var count int
+	if err := stmt.QueryRow(jti).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *revocationRepo) RevokeAllForUser(userID string, before time.Time) error {
+	stmt, err := r.db.Prepare(RevokeUserTokensQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID, before)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *revocationRepo) GetRevokedBefore(userID string) (time.Time, error) {
+	stmt, err := r.db.Prepare(GetUserRevokedBeforeQuery)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer stmt.Close()
+
+	var before time.Time
+	err = stmt.QueryRow(userID).Scan(&before)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return before, nil
+}
@@ -0,0 +1,123 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	SaveSMSOTPQuery      = "INSERT INTO sms_otp_codes (user_id, phone, code_hash, purpose, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	GetLatestSMSOTPQuery = "SELECT id, user_id, phone, code_hash, purpose, expires_at, used_at, created_at FROM sms_otp_codes WHERE user_id = ? ORDER BY id DESC LIMIT 1"
+	ListSMSOTPSinceQuery = "SELECT id, user_id, phone, code_hash, purpose, expires_at, used_at, created_at FROM sms_otp_codes WHERE user_id = ? AND created_at > ? ORDER BY id"
+	MarkSMSOTPUsedQuery  = "UPDATE sms_otp_codes SET used_at = ? WHERE id = ? AND used_at IS NULL"
+)
+
+type smsOTPRepo struct {
+	db *sql.DB
+}
+
+func NewSMSOTPRepository(db *sql.DB) service.SMSOTPRepository {
+	return &smsOTPRepo{
+		db: db,
+	}
+}
+
+func (r *smsOTPRepo) Save(c *model.SMSOTP) error {
+	stmt, err := r.db.Prepare(SaveSMSOTPQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(c.UserID, c.Phone, c.CodeHash, c.Purpose, c.ExpiresAt, c.CreatedAt)
+	if err != nil {
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = lastID
+	return nil
+}
+
+func (r *smsOTPRepo) GetLatest(userID string) (*model.SMSOTP, error) {
+	stmt, err := r.db.Prepare(GetLatestSMSOTPQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	code, err := scanSMSOTP(stmt.QueryRow(userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidPasscode
+		}
+		return nil, err
+	}
+	return code, nil
+}
+
+func (r *smsOTPRepo) ListSince(userID string, since time.Time) ([]*model.SMSOTP, error) {
+	stmt, err := r.db.Prepare(ListSMSOTPSinceQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []*model.SMSOTP
+	for rows.Next() {
+		code, err := scanSMSOTP(rows)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+func (r *smsOTPRepo) MarkUsed(id int64) error {
+	stmt, err := r.db.Prepare(MarkSMSOTPUsedQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(time.Now(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrPasscodeReused
+	}
+	return nil
+}
+
+func scanSMSOTP(row rowScanner) (*model.SMSOTP, error) {
+	var (
+		code   model.SMSOTP
+		usedAt sql.NullTime
+	)
+	err := row.Scan(&code.ID, &code.UserID, &code.Phone, &code.CodeHash, &code.Purpose, &code.ExpiresAt, &usedAt, &code.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		code.UsedAt = &usedAt.Time
+	}
+	return &code, nil
+}
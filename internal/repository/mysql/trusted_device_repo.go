@@ -0,0 +1,155 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+const (
+	SaveTrustedDeviceQuery        = "INSERT INTO trusted_devices (user_id, token_hash, name, expires_at) VALUES (?, ?, ?, ?)"
+	GetTrustedDeviceByHashQuery   = "SELECT id, user_id, token_hash, name, created_at, expires_at, last_used_at FROM trusted_devices WHERE token_hash = ?"
+	GetUserTrustedDevicesQuery    = "SELECT id, user_id, token_hash, name, created_at, expires_at, last_used_at FROM trusted_devices WHERE user_id = ? AND expires_at > ? ORDER BY id"
+	TouchTrustedDeviceQuery       = "UPDATE trusted_devices SET last_used_at = ? WHERE id = ?"
+	DeleteTrustedDeviceQuery      = "DELETE FROM trusted_devices WHERE id = ? AND user_id = ?"
+	DeleteUserTrustedDevicesQuery = "DELETE FROM trusted_devices WHERE user_id = ?"
+)
+
+type trustedDeviceRepo struct {
+	db *sql.DB
+}
+
+func NewTrustedDeviceRepository(db *sql.DB) service.TrustedDeviceRepository {
+	return &trustedDeviceRepo{
+		db: db,
+	}
+}
+
+func (r *trustedDeviceRepo) Save(d *model.TrustedDevice) error {
+	stmt, err := r.db.Prepare(SaveTrustedDeviceQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(d.UserID, d.TokenHash, d.Name, d.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	d.ID = lastID
+	return nil
+}
+
+func (r *trustedDeviceRepo) GetByHash(hash string) (*model.TrustedDevice, error) {
+	stmt, err := r.db.Prepare(GetTrustedDeviceByHashQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	device, err := scanTrustedDevice(stmt.QueryRow(hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidDeviceToken
+		}
+		return nil, err
+	}
+	return device, nil
+}
+
+// GetByUserID returns the devices of the user that have not expired yet,
+// oldest first.
+func (r *trustedDeviceRepo) GetByUserID(userID string) ([]*model.TrustedDevice, error) {
+	stmt, err := r.db.Prepare(GetUserTrustedDevicesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []*model.TrustedDevice
+	for rows.Next() {
+		device, err := scanTrustedDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+func (r *trustedDeviceRepo) Touch(id int64) error {
+	stmt, err := r.db.Prepare(TouchTrustedDeviceQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *trustedDeviceRepo) Delete(userID string, id int64) error {
+	stmt, err := r.db.Prepare(DeleteTrustedDeviceQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrTrustedDeviceNotFound
+	}
+	return nil
+}
+
+func (r *trustedDeviceRepo) DeleteAll(userID string) error {
+	stmt, err := r.db.Prepare(DeleteUserTrustedDevicesQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanTrustedDevice(row rowScanner) (*model.TrustedDevice, error) {
+	var (
+		device     model.TrustedDevice
+		lastUsedAt sql.NullTime
+	)
+	err := row.Scan(&device.ID, &device.UserID, &device.TokenHash, &device.Name, &device.CreatedAt, &device.ExpiresAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		device.LastUsedAt = &lastUsedAt.Time
+	}
+	return &device, nil
+}
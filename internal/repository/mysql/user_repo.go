@@ -3,6 +3,7 @@ package mysql
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/SantiagoBedoya/otp-api/internal/model"
 	"github.com/SantiagoBedoya/otp-api/internal/service"
@@ -11,11 +12,18 @@ import (
 
 const (
 	GetUsersQuery       = "SELECT id, first_name, last_name, email FROM users"
-	GetUserByEmailQuery = "SELECT id, email, password FROM users WHERE email = ?"
-	GetUserByIDQuery    = "SELECT email, secret_2fa FROM users WHERE id = ?"
+	GetUserByEmailQuery = "SELECT id, email, password, 2fa_valid, mfa_method, email_verified_at, email_verification_sent_at FROM users WHERE email = ?"
+	GetUserByIDQuery    = "SELECT email, password, 2fa_valid, mfa_method, phone, phone_verified, email_verified_at, email_verification_sent_at FROM users WHERE id = ?"
+	GetUserProfileQuery = "SELECT id, first_name, last_name, email FROM users WHERE id = ?"
 	SaveUserQuery       = "INSERT INTO users (first_name, last_name, email, password) VALUES (?, ?, ?, ?)"
-	SaveUserSecretQuery = "UPDATE users SET secret_2fa = ? WHERE id = ?"
-	SetValidSecretQuery = "UPDATE users SET 2fa_valid = 1 WHERE id = ?"
+	Enable2FAQuery      = "UPDATE users SET 2fa_valid = 1, mfa_method = ? WHERE id = ?"
+	ActivateSMS2FAQuery = "UPDATE users SET 2fa_valid = 1, mfa_method = 'sms', phone = ?, phone_verified = 1 WHERE id = ?"
+	Disable2FAQuery     = "UPDATE users SET 2fa_valid = 0, mfa_method = 'totp' WHERE id = ?"
+	UpdatePasswordQuery = "UPDATE users SET password = ? WHERE id = ?"
+	UpdateEmailQuery    = "UPDATE users SET email = ?, email_verified_at = ? WHERE id = ?"
+
+	SetEmailVerificationSentQuery = "UPDATE users SET email_verification_sent_at = ? WHERE id = ?"
+	MarkEmailVerifiedQuery        = "UPDATE users SET email_verified_at = ? WHERE id = ? AND email = ? AND email_verified_at IS NULL"
 )
 
 type userRepo struct {
@@ -28,22 +36,39 @@ func NewUserRepository(db *sql.DB) service.UserRepository {
 	}
 }
 
-func (r *userRepo) SaveSecret(userID, secret string) error {
-	stmt, err := r.db.Prepare(SaveUserSecretQuery)
+// Enable2FA turns 2FA on with method as the factor asked for at sign-in.
+func (r *userRepo) Enable2FA(userID, method string) error {
+	stmt, err := r.db.Prepare(Enable2FAQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(method, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ActivateSMS2FA stores the verified phone and switches the second factor
+// to texted codes.
+func (r *userRepo) ActivateSMS2FA(userID, phone string) error {
+	stmt, err := r.db.Prepare(ActivateSMS2FAQuery)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(secret, userID)
+	_, err = stmt.Exec(phone, userID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *userRepo) SetValidSecret(userID string) error {
-	stmt, err := r.db.Prepare(SetValidSecretQuery)
+func (r *userRepo) Disable2FA(userID string) error {
+	stmt, err := r.db.Prepare(Disable2FAQuery)
 	if err != nil {
 		return err
 	}
@@ -56,6 +81,39 @@ func (r *userRepo) SetValidSecret(userID string) error {
 	return nil
 }
 
+func (r *userRepo) UpdatePassword(userID, hash string) error {
+	stmt, err := r.db.Prepare(UpdatePasswordQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(hash, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateEmail stores an address the user has just verified.
+func (r *userRepo) UpdateEmail(userID, email string) error {
+	stmt, err := r.db.Prepare(UpdateEmailQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(email, time.Now(), userID)
+	if err != nil {
+		var me *mysql.MySQLError
+		if errors.As(err, &me) && me.Number == 1062 {
+			return service.ErrEmailInUse
+		}
+		return err
+	}
+	return nil
+}
+
 func (r *userRepo) Save(u *model.User) error {
 	stmt, err := r.db.Prepare(SaveUserQuery)
 	if err != nil {
@@ -111,14 +169,20 @@ func (r *userRepo) GetByEmail(email string) (*model.User, error) {
 	}
 	defer stmt.Close()
 
-	var user model.User
-	err = stmt.QueryRow(email).Scan(&user.ID, &user.Email, &user.Password)
+	var (
+		user                    model.User
+		emailVerifiedAt         sql.NullTime
+		emailVerificationSentAt sql.NullTime
+	)
+	err = stmt.QueryRow(email).Scan(&user.ID, &user.Email, &user.Password, &user.Valid2FA, &user.MFAMethod,
+		&emailVerifiedAt, &emailVerificationSentAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, service.ErrUserNotFound
 		}
 		return nil, err
 	}
+	setEmailVerification(&user, emailVerifiedAt, emailVerificationSentAt)
 	return &user, nil
 }
 
@@ -129,8 +193,73 @@ func (r *userRepo) GetByID(userID string) (*model.User, error) {
 	}
 	defer stmt.Close()
 
+	var (
+		user                    model.User
+		phone                   sql.NullString
+		emailVerifiedAt         sql.NullTime
+		emailVerificationSentAt sql.NullTime
+	)
+	err = stmt.QueryRow(userID).Scan(&user.Email, &user.Password, &user.Valid2FA, &user.MFAMethod, &phone, &user.PhoneVerified,
+		&emailVerifiedAt, &emailVerificationSentAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrUserNotFound
+		}
+		return nil, err
+	}
+	user.Phone = phone.String
+	setEmailVerification(&user, emailVerifiedAt, emailVerificationSentAt)
+	return &user, nil
+}
+
+func setEmailVerification(user *model.User, verifiedAt, sentAt sql.NullTime) {
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if sentAt.Valid {
+		user.EmailVerificationSentAt = &sentAt.Time
+	}
+}
+
+func (r *userRepo) SetEmailVerificationSent(userID string, sentAt time.Time) error {
+	stmt, err := r.db.Prepare(SetEmailVerificationSentQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(sentAt, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkEmailVerified only verifies email if it is still the address of the
+// user.
+func (r *userRepo) MarkEmailVerified(userID, email string) error {
+	stmt, err := r.db.Prepare(MarkEmailVerifiedQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now(), userID, email)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *userRepo) GetProfile(userID string) (*model.User, error) {
+	stmt, err := r.db.Prepare(GetUserProfileQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
 	var user model.User
-	err = stmt.QueryRow(userID).Scan(&user.Email, &user.Secret2FA)
+	err = stmt.QueryRow(userID).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, service.ErrUserNotFound
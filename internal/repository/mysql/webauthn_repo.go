@@ -0,0 +1,256 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	SaveWebAuthnCredentialQuery            = "INSERT INTO webauthn_credentials (user_id, name, credential_id, public_key, sign_count, transports) VALUES (?, ?, ?, ?, ?, ?)"
+	GetWebAuthnCredentialQuery             = "SELECT id, user_id, name, credential_id, public_key, sign_count, transports, created_at, last_used_at FROM webauthn_credentials WHERE credential_id = ?"
+	GetUserWebAuthnCredentialsQuery        = "SELECT id, user_id, name, credential_id, public_key, sign_count, transports, created_at, last_used_at FROM webauthn_credentials WHERE user_id = ? ORDER BY id"
+	UpdateWebAuthnCredentialSignCountQuery = "UPDATE webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ? AND sign_count = ?"
+	RenameWebAuthnCredentialQuery          = "UPDATE webauthn_credentials SET name = ? WHERE id = ? AND user_id = ?"
+	DeleteWebAuthnCredentialQuery          = "DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?"
+	DeleteUserWebAuthnCredentialsQuery     = "DELETE FROM webauthn_credentials WHERE user_id = ?"
+	SaveWebAuthnChallengeQuery             = "INSERT INTO webauthn_challenges (user_id, challenge_hash, ceremony, expires_at) VALUES (?, ?, ?, ?)"
+	GetWebAuthnChallengeQuery              = "SELECT id, user_id, challenge_hash, ceremony, expires_at FROM webauthn_challenges WHERE challenge_hash = ?"
+	DeleteWebAuthnChallengeQuery           = "DELETE FROM webauthn_challenges WHERE id = ?"
+)
+
+type webAuthnCredentialRepo struct {
+	db *sql.DB
+}
+
+func NewWebAuthnCredentialRepository(db *sql.DB) service.WebAuthnCredentialRepository {
+	return &webAuthnCredentialRepo{
+		db: db,
+	}
+}
+
+func (r *webAuthnCredentialRepo) Save(c *model.WebAuthnCredential) error {
+	stmt, err := r.db.Prepare(SaveWebAuthnCredentialQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(c.UserID, c.Name, c.CredentialID, c.PublicKey, c.SignCount, strings.Join(c.Transports, " "))
+	if err != nil {
+		var me *mysql.MySQLError
+		if errors.As(err, &me) && me.Number == 1062 {
+			return service.ErrCredentialInUse
+		}
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = lastID
+	return nil
+}
+
+func (r *webAuthnCredentialRepo) GetByCredentialID(credentialID []byte) (*model.WebAuthnCredential, error) {
+	stmt, err := r.db.Prepare(GetWebAuthnCredentialQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	cred, err := scanWebAuthnCredential(stmt.QueryRow(credentialID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidCredential
+		}
+		return nil, err
+	}
+	return cred, nil
+}
+
+func (r *webAuthnCredentialRepo) GetByUserID(userID string) ([]*model.WebAuthnCredential, error) {
+	stmt, err := r.db.Prepare(GetUserWebAuthnCredentialsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []*model.WebAuthnCredential
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, cred)
+	}
+	return creds, rows.Err()
+}
+
+// UpdateSignCount only succeeds if the stored count is still previous, so
+// two concurrent assertions cannot both move the counter.
+func (r *webAuthnCredentialRepo) UpdateSignCount(id int64, previous, signCount uint32) error {
+	stmt, err := r.db.Prepare(UpdateWebAuthnCredentialSignCountQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(signCount, time.Now(), id, previous)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrCredentialCloned
+	}
+	return nil
+}
+
+func (r *webAuthnCredentialRepo) Rename(userID string, id int64, name string) error {
+	stmt, err := r.db.Prepare(RenameWebAuthnCredentialQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(name, id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *webAuthnCredentialRepo) Delete(userID string, id int64) error {
+	stmt, err := r.db.Prepare(DeleteWebAuthnCredentialQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *webAuthnCredentialRepo) DeleteAll(userID string) error {
+	stmt, err := r.db.Prepare(DeleteUserWebAuthnCredentialsQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanWebAuthnCredential(row rowScanner) (*model.WebAuthnCredential, error) {
+	var (
+		cred       model.WebAuthnCredential
+		transports string
+		lastUsedAt sql.NullTime
+	)
+	err := row.Scan(&cred.ID, &cred.UserID, &cred.Name, &cred.CredentialID, &cred.PublicKey, &cred.SignCount, &transports, &cred.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	cred.Transports = strings.Fields(transports)
+	if lastUsedAt.Valid {
+		cred.LastUsedAt = &lastUsedAt.Time
+	}
+	return &cred, nil
+}
+
+type webAuthnChallengeRepo struct {
+	db *sql.DB
+}
+
+func NewWebAuthnChallengeRepository(db *sql.DB) service.WebAuthnChallengeRepository {
+	return &webAuthnChallengeRepo{
+		db: db,
+	}
+}
+
+func (r *webAuthnChallengeRepo) Save(c *model.WebAuthnChallenge) error {
+	stmt, err := r.db.Prepare(SaveWebAuthnChallengeQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	userID := sql.NullInt64{Int64: c.UserID, Valid: c.UserID != 0}
+	result, err := stmt.Exec(userID, c.ChallengeHash, c.Ceremony, c.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = lastID
+	return nil
+}
+
+func (r *webAuthnChallengeRepo) GetByHash(hash string) (*model.WebAuthnChallenge, error) {
+	stmt, err := r.db.Prepare(GetWebAuthnChallengeQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var (
+		challenge model.WebAuthnChallenge
+		userID    sql.NullInt64
+	)
+	err = stmt.QueryRow(hash).Scan(&challenge.ID, &userID, &challenge.ChallengeHash, &challenge.Ceremony, &challenge.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidWebAuthnChallenge
+		}
+		return nil, err
+	}
+	challenge.UserID = userID.Int64
+	return &challenge, nil
+}
+
+// Delete fails when the challenge is already gone, each challenge can only
+// be answered once.
+func (r *webAuthnChallengeRepo) Delete(id int64) error {
+	stmt, err := r.db.Prepare(DeleteWebAuthnChallengeQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return service.ErrInvalidWebAuthnChallenge
+	}
+	return nil
+}
@@ -3,24 +3,87 @@ package route
 import (
 	"database/sql"
 
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/encryption"
 	"github.com/SantiagoBedoya/otp-api/internal/handler"
 	"github.com/SantiagoBedoya/otp-api/internal/middleware"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/memory"
 	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
 	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
 	"github.com/gin-gonic/gin"
 )
 
-func InitializeAuthRoutes(gin *gin.Engine, db *sql.DB) {
+func InitializeAuthRoutes(gin *gin.Engine, db *sql.DB, keyring *encryption.Keyring, auth *middleware.Auth, revocations *service.RevocationService, keys *signing.KeySet, mailer service.Mailer, sms service.SMSSender, resetCfg config.PasswordReset, verifyCfg config.EmailVerification, policy config.PasswordPolicy, breached service.BreachedPasswords, hasher service.PasswordHasher) *service.AuthService {
 
 	repo := mysql.NewUserRepository(db)
-	service := service.NewAuthService(repo)
+	factors := mysql.NewFactorRepository(db, keyring)
+	tokenRepo := mysql.NewRefreshTokenRepository(db)
+	recoveryRepo := mysql.NewRecoveryCodeRepository(db)
+	lockoutCfg := config.LoadLockout()
+	attemptRepo := mysql.NewAttemptRepository(db)
+	if lockoutCfg.Store == "memory" {
+		attemptRepo = memory.NewAttemptRepository()
+	}
+	lockout := service.NewLockoutService(attemptRepo, lockoutCfg)
+	service := service.NewAuthService(service.AuthServiceDeps{
+		Users:             repo,
+		Factors:           factors,
+		Credentials:       mysql.NewWebAuthnCredentialRepository(db),
+		RefreshTokens:     tokenRepo,
+		RecoveryCodes:     recoveryRepo,
+		Revocations:       revocations,
+		Lockout:           lockout,
+		TOTP:              config.LoadTOTP(),
+		HOTP:              config.LoadHOTP(),
+		Keys:              keys,
+		EmailOTPs:         mysql.NewEmailOTPRepository(db),
+		Mailer:            mailer,
+		EmailOTP:          config.LoadEmailOTP(),
+		SMSOTPs:           mysql.NewSMSOTPRepository(db),
+		SMS:               sms,
+		SMSOTP:            config.LoadSMSOTP(),
+		Devices:           mysql.NewTrustedDeviceRepository(db),
+		TrustedDevice:     config.LoadTrustedDevice(),
+		Resets:            mysql.NewPasswordResetRepository(db),
+		PasswordReset:     resetCfg,
+		EmailVerification: verifyCfg,
+		PasswordPolicy:    policy,
+		Breached:          breached,
+		Hasher:            hasher,
+	})
 	handler := handler.NewAuthHandler(service)
 
 	router := gin.Group("/auth")
 	{
 		router.POST("/sign-up", handler.SignUp)
 		router.POST("/sign-in", handler.SignIn)
-		router.GET("/otp/generate", middleware.AuthMiddleware, handler.Generate)
-		router.POST("/otp/validate", middleware.AuthMiddleware, handler.ValidateOTP)
+		router.POST("/email/verify", handler.VerifyEmail)
+		router.POST("/email/resend-verification", handler.ResendVerification)
+		router.POST("/sign-out", auth.RequireAccess, handler.SignOut)
+		router.POST("/sign-out-all", auth.RequireAccess, handler.SignOutAll)
+		router.POST("/token/refresh", handler.RefreshToken)
+		router.POST("/password/forgot", handler.ForgotPassword)
+		router.POST("/password/reset", handler.ResetPassword)
+		router.GET("/otp/generate", auth.RequireAccess, handler.Generate)
+		router.POST("/otp/re-enroll", auth.RequireAccess, handler.Reenroll)
+		router.POST("/otp/disable", auth.RequireAccess, handler.Disable)
+		router.POST("/otp/validate", auth.RequireMFAPending, handler.ValidateOTP)
+		router.POST("/otp/email/enroll", auth.RequireAccess, handler.EnrollEmail)
+		router.POST("/otp/email/request", auth.RequireMFAPending, handler.RequestEmailOTP)
+		router.POST("/otp/email/verify", auth.RequireMFAPending, handler.VerifyEmailOTP)
+		router.POST("/otp/sms/enroll", auth.RequireAccess, handler.EnrollSMS)
+		router.POST("/otp/sms/request", auth.RequireMFAPending, handler.RequestSMSOTP)
+		router.POST("/otp/sms/verify", auth.RequireMFAPending, handler.VerifySMSOTP)
+		router.POST("/otp/hotp/enroll", auth.RequireAccess, handler.EnrollHOTP)
+		router.POST("/otp/hotp/resync", auth.RequireMFAPending, handler.ResyncHOTP)
+		router.GET("/otp/factors", auth.RequireAccess, handler.ListFactors)
+		router.PATCH("/otp/factors/:id", auth.RequireAccess, handler.RenameFactor)
+		router.DELETE("/otp/factors/:id", auth.RequireAccess, handler.DeleteFactor)
+		router.POST("/otp/recovery-codes", auth.RequireAccess, handler.RegenerateRecoveryCodes)
+		router.GET("/devices", auth.RequireAccess, handler.ListTrustedDevices)
+		router.DELETE("/devices", auth.RequireAccess, handler.RevokeTrustedDevices)
+		router.DELETE("/devices/:id", auth.RequireAccess, handler.RevokeTrustedDevice)
 	}
+	return service
 }
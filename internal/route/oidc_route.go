@@ -0,0 +1,34 @@
+package route
+
+import (
+	"database/sql"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/handler"
+	"github.com/SantiagoBedoya/otp-api/internal/middleware"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
+	"github.com/gin-gonic/gin"
+)
+
+func InitializeOIDCRoutes(gin *gin.Engine, db *sql.DB, auth *middleware.Auth, authService *service.AuthService, keys *signing.KeySet) {
+	clients := service.NewClientService(mysql.NewOAuthClientRepository(db))
+	codeRepo := mysql.NewAuthorizationCodeRepository(db)
+	repo := mysql.NewUserRepository(db)
+	service := service.NewOIDCService(authService, clients, codeRepo, repo, keys, config.LoadOIDC())
+	handler := handler.NewOIDCHandler(service)
+
+	gin.GET("/.well-known/openid-configuration", handler.Discovery)
+
+	router := gin.Group("/oauth")
+	{
+		router.GET("/authorize", handler.AuthorizeForm)
+		router.POST("/authorize", handler.Authorize)
+		router.POST("/token", handler.Token)
+		router.POST("/introspect", handler.Introspect)
+		router.POST("/revoke", handler.Revoke)
+		router.GET("/userinfo", auth.RequireClientAccess, handler.UserInfo)
+		router.POST("/userinfo", auth.RequireClientAccess, handler.UserInfo)
+	}
+}
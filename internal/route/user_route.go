@@ -5,18 +5,28 @@ import (
 
 	"github.com/SantiagoBedoya/otp-api/internal/handler"
 	"github.com/SantiagoBedoya/otp-api/internal/middleware"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
 	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
 	"github.com/SantiagoBedoya/otp-api/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
-func InitializeUserRoutes(gin *gin.Engine, db *sql.DB) {
+func InitializeUserRoutes(gin *gin.Engine, db *sql.DB, auth *middleware.Auth, authService *service.AuthService) {
 	repo := mysql.NewUserRepository(db)
 	service := service.NewUserService(repo)
-	handler := handler.NewUserHandler(service)
+	handler := handler.NewUserHandler(service, authService)
 
-	router := gin.Group("/users", middleware.AuthMiddleware)
+	router := gin.Group("/users", auth.RequireAccess, auth.RequireAMR(model.AMRMFA))
 	{
 		router.GET("", handler.GetUsers)
 	}
+
+	// Users without 2FA manage their own account too, the services ask for
+	// a second factor only when one is enabled.
+	me := gin.Group("/users/me", auth.RequireAccess)
+	{
+		me.PUT("/password", handler.ChangePassword)
+		me.POST("/email", handler.ChangeEmail)
+		me.POST("/email/confirm", handler.ConfirmEmailChange)
+	}
 }
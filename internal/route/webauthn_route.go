@@ -0,0 +1,32 @@
+package route
+
+import (
+	"database/sql"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/handler"
+	"github.com/SantiagoBedoya/otp-api/internal/middleware"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+func InitializeWebAuthnRoutes(gin *gin.Engine, db *sql.DB, auth *middleware.Auth, authService *service.AuthService) {
+	cfg := config.LoadWebAuthn()
+	credentials := mysql.NewWebAuthnCredentialRepository(db)
+	challenges := mysql.NewWebAuthnChallengeRepository(db)
+	service := service.NewWebAuthnService(authService, credentials, challenges, cfg)
+	handler := handler.NewWebAuthnHandler(service)
+
+	router := gin.Group("/auth/webauthn")
+	{
+		router.POST("/register/begin", auth.RequireAccess, auth.RequireFreshAuth(cfg.RegistrationMaxAge), handler.BeginRegistration)
+		router.POST("/register/finish", auth.RequireAccess, auth.RequireFreshAuth(cfg.RegistrationMaxAge), handler.FinishRegistration)
+		router.POST("/login/begin", auth.RequireMFAPending, handler.BeginLogin)
+		router.POST("/login/finish", auth.RequireMFAPending, handler.FinishLogin)
+		router.POST("/passkey/begin", handler.BeginPasskeyLogin)
+		router.POST("/passkey/finish", handler.FinishPasskeyLogin)
+		router.GET("/credentials", auth.RequireAccess, handler.ListCredentials)
+		router.DELETE("/credentials/:id", auth.RequireAccess, handler.DeleteCredential)
+	}
+}
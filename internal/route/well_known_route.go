@@ -0,0 +1,16 @@
+package route
+
+import (
+	"github.com/SantiagoBedoya/otp-api/internal/handler"
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
+	"github.com/gin-gonic/gin"
+)
+
+func InitializeWellKnownRoutes(gin *gin.Engine, keys *signing.KeySet) {
+	handler := handler.NewWellKnownHandler(keys)
+
+	router := gin.Group("/.well-known")
+	{
+		router.GET("/jwks.json", handler.JWKS)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ChangePassword replaces the password once the user proves their
+// identity with the current one, and a second factor when 2FA is enabled.
+// Every session and trusted device is revoked, the user signs in again
+// with the new password.
+func (s *AuthService) ChangePassword(userID string, data *dto.ChangePasswordDto, clientIP string) error {
+	if data.NewPassword == "" {
+		return ErrPasswordRequired
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	// Checked first so a rejected password does not use up the passcode.
+	if err := s.validatePassword(data.NewPassword, user); err != nil {
+		return err
+	}
+	if err := s.verifyOwner(userID, clientIP, user, &data.VerifyIdentityDto); err != nil {
+		return err
+	}
+	hash, err := s.hasher.Hash(data.NewPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(userID, hash); err != nil {
+		return err
+	}
+	if err := s.SignOutAll(userID); err != nil {
+		return err
+	}
+	return s.devices.DeleteAll(userID)
+}
+
+// ChangeEmail mails a confirmation link to the new address once the user
+// proves their identity. The address only changes when that link is
+// confirmed with ConfirmEmailChange. Reset links already mailed to the
+// current address stop working.
+func (s *AuthService) ChangeEmail(userID string, data *dto.ChangeEmailDto, clientIP string) error {
+	email := strings.TrimSpace(data.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyOwner(userID, clientIP, user, &data.VerifyIdentityDto); err != nil {
+		return err
+	}
+	if err := s.checkEmailAvailable(email); err != nil {
+		return err
+	}
+	if err := s.resets.InvalidateAll(userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	token, err := s.keys.Sign(model.EmailVerificationClaims{
+		Scope:         model.ScopeChangeEmail,
+		Email:         email,
+		PreviousEmail: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "otp-api",
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.verifyCfg.TTL)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(s.verifyCfg.ChangeURL, token)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(&model.MailMessage{
+		To:      email,
+		Subject: fmt.Sprintf("Confirm your new %s email address", s.totpCfg.Issuer),
+		Body: fmt.Sprintf("Open the link below to use this address for your account:\n\n%s\n\nIt expires in %d hours. If you did not ask for it, you can ignore this email.\n",
+			link, int(s.verifyCfg.TTL.Hours())),
+	})
+}
+
+// ConfirmEmailChange swaps the address of the user for the one in the
+// link and lets the previous address know. Authenticator apps enrolled
+// from then on are labelled with the new address, as the otpauth URI is
+// built from the current email.
+func (s *AuthService) ConfirmEmailChange(userID string, data *dto.VerifyEmailDto) error {
+	var claims model.EmailVerificationClaims
+	parsed, err := jwt.ParseWithClaims(data.Token, &claims, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.Methods()))
+	if err != nil || !parsed.Valid || claims.Scope != model.ScopeChangeEmail || claims.Subject != userID {
+		return ErrInvalidVerificationToken
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Email != claims.PreviousEmail {
+		return ErrInvalidVerificationToken
+	}
+	if err := s.checkEmailAvailable(claims.Email); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateEmail(userID, claims.Email); err != nil {
+		return err
+	}
+	return s.mailer.Send(&model.MailMessage{
+		To:      claims.PreviousEmail,
+		Subject: fmt.Sprintf("Your %s email address was changed", s.totpCfg.Issuer),
+		Body: fmt.Sprintf("The email address of your account was changed to %s.\n\nIf you did not do this, contact support right away.\n",
+			claims.Email),
+	})
+}
+
+// verifyOwner requires the current password, plus a second factor when the
+// user has 2FA enabled. Failures are throttled like verifyIdentity.
+func (s *AuthService) verifyOwner(userID, clientIP string, user *model.User, data *dto.VerifyIdentityDto) error {
+	if user.Valid2FA {
+		return s.verifyIdentity(userID, clientIP, user, data)
+	}
+	_, err := s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+		if err := s.hasher.Compare(user.Password, data.Password); err != nil {
+			return nil, ErrInvalidPassword
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (s *AuthService) checkEmailAvailable(email string) error {
+	_, err := s.repo.GetByEmail(email)
+	if err == nil {
+		return ErrEmailInUse
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package service_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/pquerna/otp/totp"
+)
+
+// expectIdentity expects verifyIdentity to check the password and a code
+// of the authenticator app generated from secret.
+func expectIdentity(mock sqlmock.Sqlmock, email, secret string) {
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow(email, "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", secret, "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestChangePassword(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = svc.ChangePassword("1", &dto.ChangePasswordDto{VerifyIdentityDto: dto.VerifyIdentityDto{Password: "santiago123", Code: code}}, "127.0.0.1")
+	if !errors.Is(err, service.ErrPasswordRequired) {
+		t.Errorf("expected error: %v, got %v", service.ErrPasswordRequired, err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", true, "totp", nil, false, time.Now(), nil))
+	err = svc.ChangePassword("1", &dto.ChangePasswordDto{
+		NewPassword:       "new-password",
+		VerifyIdentityDto: dto.VerifyIdentityDto{Password: "wrong", Code: code},
+	}, "127.0.0.1")
+	if !errors.Is(err, service.ErrInvalidPassword) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidPassword, err)
+	}
+
+	expectIdentity(mock, "santiago@google.com", key.Secret())
+	mock.ExpectPrepare(mysql.UpdatePasswordQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.RevokeUserRefreshTokensQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectPrepare(mysql.DeleteUserTrustedDevicesQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = svc.ChangePassword("1", &dto.ChangePasswordDto{
+		NewPassword:       "new-password",
+		VerifyIdentityDto: dto.VerifyIdentityDto{Password: "santiago123", Code: code},
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChangePasswordWithout2FA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", false, "", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.UpdatePasswordQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.RevokeUserRefreshTokensQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.DeleteUserTrustedDevicesQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = svc.ChangePassword("1", &dto.ChangePasswordDto{
+		NewPassword:       "new-password",
+		VerifyIdentityDto: dto.VerifyIdentityDto{Password: "santiago123"},
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("the current password should be enough without 2FA, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := dto.VerifyIdentityDto{Password: "santiago123", Code: code}
+
+	err = svc.ChangeEmail("1", &dto.ChangeEmailDto{Email: "not an address", VerifyIdentityDto: identity}, "127.0.0.1")
+	if !errors.Is(err, service.ErrInvalidEmail) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidEmail, err)
+	}
+
+	expectIdentity(mock, "santiago@google.com", key.Secret())
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("santiago@yahoo.com").
+		WillReturnRows(userByEmailRows())
+	mock.ExpectPrepare(mysql.InvalidatePasswordResetsQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = svc.ChangeEmail("1", &dto.ChangeEmailDto{Email: "santiago@yahoo.com", VerifyIdentityDto: identity}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := testMailer.Last()
+	if msg == nil || msg.To != "santiago@yahoo.com" {
+		t.Fatalf("expected a confirmation link to be mailed to the new address, got %+v", msg)
+	}
+	token := regexp.MustCompile(`token=([\w.-]+)`).FindStringSubmatch(msg.Body)
+	if token == nil {
+		t.Fatalf("no confirmation link in %q", msg.Body)
+	}
+
+	if err := svc.ConfirmEmailChange("2", &dto.VerifyEmailDto{Token: token[1]}); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Errorf("a link for another user should be rejected, got %v", err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("santiago@yahoo.com").
+		WillReturnRows(userByEmailRows())
+	mock.ExpectPrepare(mysql.UpdateEmailQuery).
+		ExpectExec().
+		WithArgs("santiago@yahoo.com", sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.ConfirmEmailChange("1", &dto.VerifyEmailDto{Token: token[1]}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	notice := testMailer.Last()
+	if notice == nil || notice.To != "santiago@google.com" {
+		t.Errorf("expected the previous address to be notified, got %+v", notice)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@yahoo.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	if err := svc.ConfirmEmailChange("1", &dto.VerifyEmailDto{Token: token[1]}); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Errorf("a link should not apply once the address has changed, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
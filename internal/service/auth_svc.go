@@ -1,94 +1,539 @@
 package service
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"image/png"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/SantiagoBedoya/otp-api/internal/config"
 	"github.com/SantiagoBedoya/otp-api/internal/dto"
 	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
-	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	passwordAMR = []string{model.AMRPassword}
+	mfaAMR      = []string{model.AMRPassword, model.AMROTP, model.AMRMFA}
+	recoveryAMR = []string{model.AMRPassword, model.AMRRecovery, model.AMRMFA}
+)
+
+func acrFor(amr []string) string {
+	if model.HasAMR(amr, model.AMRMFA) {
+		return model.ACRMFA
+	}
+	return model.ACRPassword
+}
+
 type AuthService struct {
-	repo UserRepository
+	repo         UserRepository
+	factors      FactorRepository
+	credentials  WebAuthnCredentialRepository
+	tokenRepo    RefreshTokenRepository
+	recoveryRepo RecoveryCodeRepository
+	revocations  *RevocationService
+	lockout      *LockoutService
+	totpCfg      config.TOTP
+	hotpCfg      config.HOTP
+	keys         *signing.KeySet
+	emailOTPs    EmailOTPRepository
+	mailer       Mailer
+	emailCfg     config.EmailOTP
+	smsOTPs      SMSOTPRepository
+	sms          SMSSender
+	smsCfg       config.SMSOTP
+	devices      TrustedDeviceRepository
+	deviceCfg    config.TrustedDevice
+	resets       PasswordResetRepository
+	resetCfg     config.PasswordReset
+	verifyCfg    config.EmailVerification
+	policy       config.PasswordPolicy
+	breached     BreachedPasswords
+	hasher       PasswordHasher
 }
 
-func NewAuthService(repo UserRepository) *AuthService {
+// AuthServiceDeps holds what NewAuthService wires into the service.
+type AuthServiceDeps struct {
+	Users             UserRepository
+	Factors           FactorRepository
+	Credentials       WebAuthnCredentialRepository
+	RefreshTokens     RefreshTokenRepository
+	RecoveryCodes     RecoveryCodeRepository
+	Revocations       *RevocationService
+	Lockout           *LockoutService
+	TOTP              config.TOTP
+	HOTP              config.HOTP
+	Keys              *signing.KeySet
+	EmailOTPs         EmailOTPRepository
+	Mailer            Mailer
+	EmailOTP          config.EmailOTP
+	SMSOTPs           SMSOTPRepository
+	SMS               SMSSender
+	SMSOTP            config.SMSOTP
+	Devices           TrustedDeviceRepository
+	TrustedDevice     config.TrustedDevice
+	Resets            PasswordResetRepository
+	PasswordReset     config.PasswordReset
+	EmailVerification config.EmailVerification
+	PasswordPolicy    config.PasswordPolicy
+	Breached          BreachedPasswords
+	Hasher            PasswordHasher
+}
+
+func NewAuthService(deps AuthServiceDeps) *AuthService {
 	return &AuthService{
-		repo: repo,
+		repo:         deps.Users,
+		factors:      deps.Factors,
+		credentials:  deps.Credentials,
+		tokenRepo:    deps.RefreshTokens,
+		recoveryRepo: deps.RecoveryCodes,
+		revocations:  deps.Revocations,
+		lockout:      deps.Lockout,
+		totpCfg:      deps.TOTP,
+		hotpCfg:      deps.HOTP,
+		keys:         deps.Keys,
+		emailOTPs:    deps.EmailOTPs,
+		mailer:       deps.Mailer,
+		emailCfg:     deps.EmailOTP,
+		smsOTPs:      deps.SMSOTPs,
+		sms:          deps.SMS,
+		smsCfg:       deps.SMSOTP,
+		devices:      deps.Devices,
+		deviceCfg:    deps.TrustedDevice,
+		resets:       deps.Resets,
+		resetCfg:     deps.PasswordReset,
+		verifyCfg:    deps.EmailVerification,
+		policy:       deps.PasswordPolicy,
+		breached:     deps.Breached,
+		hasher:       deps.Hasher,
+	}
+}
+
+// SignIn checks the password and hands out an MFA pending token when 2FA
+// is enabled, unless data carries the token of a trusted device. An
+// invalid device token falls back to asking for the second factor.
+func (s *AuthService) SignIn(data *dto.SignInDto, clientIP string) (*dto.TokenDto, error) {
+	user, err := s.checkPassword(data, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if user.Valid2FA {
+		if data.DeviceToken != "" {
+			err := s.checkTrustedDevice(fmt.Sprint(user.ID), data.DeviceToken)
+			if err == nil {
+				return s.issueTokens(fmt.Sprint(user.ID), "", trustedDeviceAMR, time.Now())
+			}
+			if !errors.Is(err, ErrInvalidDeviceToken) {
+				return nil, err
+			}
+		}
+		token, err := s.GenerateMFAPendingToken(fmt.Sprint(user.ID))
+		if err != nil {
+			return nil, err
+		}
+		return &dto.TokenDto{MFAToken: token, MFARequired: true, MFAMethod: user.MFAMethod}, nil
 	}
+	return s.issueTokens(fmt.Sprint(user.ID), "", passwordAMR, time.Now())
 }
 
-func (s *AuthService) SignIn(data *dto.SignInDto) (string, error) {
+// Authenticate checks the password and, when 2FA is enabled, the second
+// factor in a single step and returns the methods used. It is meant for
+// flows that cannot hand out an MFA pending token, like the OIDC login form.
+// The second factor is a code from an authenticator or a recovery code.
+// Users with the email factor get a code sent when none is given. Security
+// keys need a WebAuthn ceremony this flow cannot run, their users get
+// ErrSecurityKeyUnsupported and sign in with a recovery code instead.
+func (s *AuthService) Authenticate(data *dto.SignInDto, code, recoveryCode, clientIP string) (*model.User, []string, error) {
+	user, err := s.checkPassword(data, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.Valid2FA {
+		return user, passwordAMR, nil
+	}
+	userID := fmt.Sprint(user.ID)
+	if code == "" && recoveryCode == "" {
+		if user.MFAMethod == model.MFAMethodWebAuthn {
+			return nil, nil, ErrSecurityKeyUnsupported
+		}
+		if err := s.sendSecondFactorCode(userID, user); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrMFARequired
+	}
+	amr := mfaAMR
+	_, err = s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+		if recoveryCode != "" {
+			amr = recoveryAMR
+			return nil, s.useRecoveryCode(userID, recoveryCode)
+		}
+		secrets, err := s.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.verifySecondFactor(userID, secrets, code)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, amr, nil
+}
+
+// sendSecondFactorCode emails or texts a code to users whose second factor
+// is email or SMS, other factors generate their own codes.
+func (s *AuthService) sendSecondFactorCode(userID string, user *model.User) error {
+	switch user.MFAMethod {
+	case model.MFAMethodEmail:
+		return s.sendEmailOTP(userID, user.Email, model.OTPVerify)
+	case model.MFAMethodSMS:
+		return s.RequestSMSOTP(userID)
+	}
+	return nil
+}
+
+func (s *AuthService) checkPassword(data *dto.SignInDto, clientIP string) (*model.User, error) {
+	account := "signin:" + strings.ToLower(data.Email)
+	if err := s.lockout.Reserve(account, clientIP); err != nil {
+		return nil, err
+	}
 	user, err := s.repo.GetByEmail(data.Email)
 	if err != nil {
-		return "", err
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, s.releaseAttempt(account, clientIP, err)
+	}
+	if err := s.hasher.Compare(user.Password, data.Password); err != nil {
+		return nil, ErrInvalidPassword
+	}
+	if err := s.lockout.Reset(account, clientIP); err != nil {
+		return nil, err
+	}
+	if err := s.rehashPassword(user, data.Password); err != nil {
+		return nil, err
+	}
+	if err := s.requireVerifiedEmail(user, config.EmailVerificationSignIn); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Setup2FA starts the first enrollment of an authenticator app. The secret
+// stays pending until a code generated from it is validated.
+func (s *AuthService) Setup2FA(userID string, data *dto.TOTPOptionsDto) (*otp.Key, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Valid2FA {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err := s.requireVerifiedEmail(user, config.EmailVerificationEnrollment); err != nil {
+		return nil, err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password))
+	return s.enroll2FA(userID, user.Email, data)
+}
+
+// Reenroll2FA adds another authenticator app, e.g. on a new phone. The
+// factors already enrolled keep working, old ones can be deleted once the
+// new one is confirmed.
+func (s *AuthService) Reenroll2FA(userID string, data *dto.TOTPEnrollDto, clientIP string) (*otp.Key, error) {
+	user, err := s.GetUserByID(userID)
 	if err != nil {
-		return "", ErrInvalidPassword
+		return nil, err
 	}
-	token, err := s.GenerateAccessToken(fmt.Sprint(user.ID))
+	if err := s.requireVerifiedEmail(user, config.EmailVerificationEnrollment); err != nil {
+		return nil, err
+	}
+	if err := s.verifyIdentity(userID, clientIP, user, &data.VerifyIdentityDto); err != nil {
+		return nil, err
+	}
+	return s.enroll2FA(userID, user.Email, &data.TOTPOptionsDto)
+}
+
+func (s *AuthService) Disable2FA(userID string, data *dto.VerifyIdentityDto, clientIP string) error {
+	user, err := s.GetUserByID(userID)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return token, nil
+	if err := s.verifyIdentity(userID, clientIP, user, data); err != nil {
+		return err
+	}
+	return s.turnOff2FA(userID)
 }
 
-func (s *AuthService) Setup2FA(userID, email string) ([]byte, error) {
+// turnOff2FA clears the 2FA method of the user along with their factors,
+// trusted devices and recovery codes.
+func (s *AuthService) turnOff2FA(userID string) error {
+	if err := s.repo.Disable2FA(userID); err != nil {
+		return err
+	}
+	if err := s.factors.DeleteAll(userID); err != nil {
+		return err
+	}
+	if err := s.credentials.DeleteAll(userID); err != nil {
+		return err
+	}
+	if err := s.devices.DeleteAll(userID); err != nil {
+		return err
+	}
+	return s.recoveryRepo.ReplaceAll(userID, nil)
+}
+
+// enroll2FA replaces any factor still pending with a new authenticator app.
+func (s *AuthService) enroll2FA(userID, email string, data *dto.TOTPOptionsDto) (*otp.Key, error) {
+	name, err := factorName(data.Name, "Authenticator app")
+	if err != nil {
+		return nil, err
+	}
+	params, err := s.totpParams(data)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
 	key, err := totp.Generate(totp.GenerateOpts{
 		AccountName: email,
-		Issuer:      "otp-api",
+		Issuer:      s.totpCfg.Issuer,
+		Period:      params.Period,
+		Digits:      otp.Digits(params.Digits),
+		Algorithm:   otpAlgorithm(params.Algorithm),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.SetUser2FA(userID, key.Secret()); err != nil {
+	if err := s.factors.DeletePending(userID); err != nil {
 		return nil, err
 	}
-	var buf bytes.Buffer
-	img, err := key.Image(200, 200)
+	err = s.factors.Save(&model.Factor{
+		UserID:    id,
+		Type:      model.MFAMethodTOTP,
+		Name:      name,
+		Secret:    key.Secret(),
+		Params:    params,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// verifyIdentity requires the password plus a code from the active
+// authenticator or a recovery code. Failures count towards the lockout of
+// the second factor, a stolen access token is not enough to guess them.
+func (s *AuthService) verifyIdentity(userID, clientIP string, user *model.User, data *dto.VerifyIdentityDto) error {
+	if !user.Valid2FA {
+		return ErrMFANotEnabled
+	}
+	_, err := s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+		if err := s.hasher.Compare(user.Password, data.Password); err != nil {
+			return nil, ErrInvalidPassword
+		}
+		if data.RecoveryCode != "" {
+			return nil, s.useRecoveryCode(userID, data.RecoveryCode)
+		}
+		return nil, s.verifySecondFactor(userID, user, data.Code)
+	})
+	return err
+}
+
+// verifySecondFactor checks code against the last emailed or texted code
+// when that is the method of the user, then against every active
+// authenticator app and HOTP fob.
+func (s *AuthService) verifySecondFactor(userID string, user *model.User, code string) error {
+	factors, err := s.factors.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+	return s.checkSecondFactor(userID, user, factors, code)
+}
+
+func (s *AuthService) checkSecondFactor(userID string, user *model.User, factors []*model.Factor, code string) error {
+	switch user.MFAMethod {
+	case model.MFAMethodEmail:
+		if _, err := s.checkEmailOTP(userID, model.OTPVerify, code); !errors.Is(err, ErrInvalidPasscode) {
+			return err
+		}
+	case model.MFAMethodSMS:
+		if _, err := s.checkSMSOTP(userID, model.OTPVerify, code); !errors.Is(err, ErrInvalidPasscode) {
+			return err
+		}
+	}
+	return s.validateFactor(factors, code)
+}
+
+func (s *AuthService) Validate2FA(userID string, data *dto.OTPDto, clientIP string) (*dto.TokenDto, error) {
+	tokens, err := s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+		return s.validate2FA(userID, data)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if err := png.Encode(&buf, img); err != nil {
+	if data.RememberDevice {
+		tokens.DeviceToken, err = s.trustDevice(userID, data.DeviceName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// throttleOTP runs validate under the lockout of the user's second factor.
+// The attempt is counted before validate runs and only given back when it
+// succeeds or fails for another reason than a wrong credential.
+func (s *AuthService) throttleOTP(userID, clientIP string, validate func() (*dto.TokenDto, error)) (*dto.TokenDto, error) {
+	account := "otp:" + userID
+	if err := s.lockout.Reserve(account, clientIP); err != nil {
+		return nil, err
+	}
+	tokens, err := validate()
+	if err != nil {
+		if errors.Is(err, ErrInvalidPasscode) || errors.Is(err, ErrInvalidRecoveryCode) || errors.Is(err, ErrInvalidPassword) {
+			return nil, err
+		}
+		return nil, s.releaseAttempt(account, clientIP, err)
+	}
+	if err := s.lockout.Reset(account, clientIP); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return tokens, nil
 }
 
-func (s *AuthService) Validate2FA(userID string, data *dto.OTPDto) (string, error) {
+// releaseAttempt gives back the attempt reserved on the lockout and returns
+// the original error unless the counter could not be stored.
+func (s *AuthService) releaseAttempt(account, clientIP string, err error) error {
+	if lerr := s.lockout.Release(account, clientIP); lerr != nil {
+		return lerr
+	}
+	return err
+}
+
+func (s *AuthService) validate2FA(userID string, data *dto.OTPDto) (*dto.TokenDto, error) {
 	user, err := s.GetUserByID(userID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	isValid := totp.Validate(data.Code, user.Secret2FA)
-	if !isValid {
-		return "", ErrInvalidPasscode
+	if data.RecoveryCode != "" {
+		if !user.Valid2FA {
+			return nil, ErrMFANotEnabled
+		}
+		if err := s.useRecoveryCode(userID, data.RecoveryCode); err != nil {
+			return nil, err
+		}
+		return s.issueTokens(userID, "", recoveryAMR, time.Now())
 	}
-	if err := s.SetUser2FAValid(userID); err != nil {
-		return "", err
+	factors, err := s.factors.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending := pendingFactor(factors); pending != nil {
+		err := s.validateTOTP(pending, data.Code)
+		if err == nil {
+			return s.confirm2FA(userID, user, func(userID string) error {
+				return s.activateFactor(userID, pending)
+			})
+		}
+		if errors.Is(err, ErrPasscodeReused) || !errors.Is(err, ErrInvalidPasscode) {
+			return nil, err
+		}
+	}
+	if !user.Valid2FA {
+		return nil, ErrInvalidPasscode
 	}
-	token, err := s.GenerateAccessToken(userID)
+	if err := s.checkSecondFactor(userID, user, factors, data.Code); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(userID, "", mfaAMR, time.Now())
+}
+
+// confirm2FA makes a new factor active through activate. Recovery codes are
+// only handed out the first time, re-enrollment keeps the existing set.
+func (s *AuthService) confirm2FA(userID string, user *model.User, activate func(userID string) error) (*dto.TokenDto, error) {
+	if err := activate(userID); err != nil {
+		return nil, err
+	}
+	tokens, err := s.issueTokens(userID, "", mfaAMR, time.Now())
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if user.Valid2FA {
+		return tokens, nil
 	}
-	return token, nil
+	codes, err := s.GenerateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	tokens.RecoveryCodes = codes
+	return tokens, nil
+}
+
+func (s *AuthService) RegenerateRecoveryCodes(userID string, data *dto.OTPDto, clientIP string) ([]string, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Valid2FA {
+		return nil, ErrMFANotEnabled
+	}
+	_, err = s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+		return nil, s.verifySecondFactor(userID, user, data.Code)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GenerateRecoveryCodes(userID)
+}
+
+// GenerateAccessToken issues an access token for a user who signed in at
+// authTime with the amr methods.
+func (s *AuthService) GenerateAccessToken(userID, sessionID string, amr []string, authTime time.Time) (string, error) {
+	return s.generateAccessToken(userID, sessionID, "", "", amr, authTime)
 }
 
-func (s *AuthService) GenerateAccessToken(userID string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+// generateAccessToken issues an access token, for the OAuth client clientID
+// with the granted scope when clientID is not empty.
+func (s *AuthService) generateAccessToken(userID, sessionID, clientID, scope string, amr []string, authTime time.Time) (string, error) {
+	return s.generateToken(userID, accessTokenTTL, model.Claims{
+		Scope:      model.ScopeAccess,
+		ClientID:   clientID,
+		OAuthScope: scope,
+		SessionID:  sessionID,
+		AMR:        amr,
+		ACR:        acrFor(amr),
+		AuthTime:   jwt.NewNumericDate(authTime),
+	})
+}
+
+func (s *AuthService) GenerateMFAPendingToken(userID string) (string, error) {
+	return s.generateToken(userID, time.Minute*5, model.Claims{
+		Scope: model.ScopeMFAPending,
+		AMR:   passwordAMR,
+	})
+}
+
+// generateToken fills in the registered claims and signs claims.
+func (s *AuthService) generateToken(userID string, ttl time.Duration, claims model.Claims) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
 		Issuer:    "otp-api",
 		Subject:   fmt.Sprint(userID),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
-	})
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	tokenString, err := s.keys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -103,25 +548,20 @@ func (s *AuthService) GetUserByID(userID string) (*model.User, error) {
 	return user, nil
 }
 
-func (s *AuthService) SetUser2FA(userID, secret string) error {
-	return s.repo.SaveSecret(userID, secret)
-}
-
-func (s *AuthService) SetUser2FAValid(userID string) error {
-	return s.repo.SetValidSecret(userID)
-}
-
 func (s *AuthService) SaveUser(data *dto.SignUpDto) (*model.User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
-	}
 	user := &model.User{
 		FirstName: data.FirstName,
 		LastName:  data.LastName,
 		Email:     data.Email,
-		Password:  string(hash),
 	}
+	if err := s.validatePassword(data.Password, user); err != nil {
+		return nil, err
+	}
+	hash, err := s.hasher.Hash(data.Password)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = hash
 	err = s.repo.Save(user)
 	if err != nil {
 		return nil, err
@@ -1,16 +1,118 @@
 package service_test
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/config"
 	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/encryption"
+	"github.com/SantiagoBedoya/otp-api/internal/mailer"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/passhash"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/memory"
 	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
 	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
+	"github.com/SantiagoBedoya/otp-api/internal/sms"
 	mmysql "github.com/go-sql-driver/mysql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
 )
 
+func newKeyring() *encryption.Keyring {
+	keyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": make([]byte, 32)})
+	if err != nil {
+		panic(err)
+	}
+	return keyring
+}
+
+// newHasher matches the cost of the bcrypt hashes in these tests, so signing
+// in does not rehash them.
+func newHasher() service.PasswordHasher {
+	hasher, err := passhash.NewBcrypt(bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hasher
+}
+
+var (
+	testKeys   = signing.NewHMACKeySet([]byte("secret"))
+	testMailer = mailer.NewMemoryMailer()
+	testSMS    = sms.NewFakeSender()
+)
+
+func newAuthService(db *sql.DB) *service.AuthService {
+	return service.NewAuthService(authServiceDeps(db))
+}
+
+// authServiceDeps returns the test dependencies, tests override the ones
+// they exercise before calling service.NewAuthService.
+func authServiceDeps(db *sql.DB) service.AuthServiceDeps {
+	lockoutCfg := config.DefaultLockout()
+	lockoutCfg.BaseDelay = 0
+	return service.AuthServiceDeps{
+		Users:             mysql.NewUserRepository(db),
+		Factors:           mysql.NewFactorRepository(db, newKeyring()),
+		Credentials:       mysql.NewWebAuthnCredentialRepository(db),
+		RefreshTokens:     mysql.NewRefreshTokenRepository(db),
+		RecoveryCodes:     mysql.NewRecoveryCodeRepository(db),
+		Revocations:       service.NewRevocationService(memory.NewRevocationRepository()),
+		Lockout:           service.NewLockoutService(memory.NewAttemptRepository(), lockoutCfg),
+		TOTP:              config.DefaultTOTP(),
+		HOTP:              config.DefaultHOTP(),
+		Keys:              testKeys,
+		EmailOTPs:         mysql.NewEmailOTPRepository(db),
+		Mailer:            testMailer,
+		EmailOTP:          config.DefaultEmailOTP(),
+		SMSOTPs:           mysql.NewSMSOTPRepository(db),
+		SMS:               testSMS,
+		SMSOTP:            config.DefaultSMSOTP(),
+		Devices:           mysql.NewTrustedDeviceRepository(db),
+		TrustedDevice:     config.DefaultTrustedDevice(),
+		Resets:            mysql.NewPasswordResetRepository(db),
+		PasswordReset:     config.DefaultPasswordReset(),
+		EmailVerification: config.DefaultEmailVerification(),
+		PasswordPolicy:    config.DefaultPasswordPolicy(),
+		Hasher:            newHasher(),
+	}
+}
+
+// capturedArg matches any string argument and keeps its value.
+type capturedArg struct {
+	value string
+}
+
+func (a *capturedArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	a.value = s
+	return ok
+}
+
+func userByIDRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"email", "password", "2fa_valid", "mfa_method", "phone", "phone_verified",
+		"email_verified_at", "email_verification_sent_at"})
+}
+
+func userByEmailRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "email", "password", "2fa_valid", "mfa_method", "email_verified_at", "email_verification_sent_at"})
+}
+
+func factorRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "type", "name", "secret", "otp_algorithm", "otp_digits", "otp_period",
+		"counter", "last_otp_at", "active", "created_at", "last_used_at"})
+}
+
 func TestSignIn(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -18,42 +120,87 @@ func TestSignIn(t *testing.T) {
 	}
 	defer db.Close()
 
-	repo := mysql.NewUserRepository(db)
-	svc := service.NewAuthService(repo)
+	svc := newAuthService(db)
 
-	mock.ExpectPrepare("SELECT id, email, password FROM users WHERE email = ?")
-	mock.ExpectQuery("SELECT id, email, password FROM users WHERE email = ?").
+	mock.ExpectPrepare(regexp.QuoteMeta(mysql.GetUserByEmailQuery))
+	mock.ExpectQuery(regexp.QuoteMeta(mysql.GetUserByEmailQuery)).
 		WithArgs("santiago@google.com").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password"}).
-			AddRow(1, "santiago@google.com", "hash123"))
+		WillReturnRows(userByEmailRows().
+			AddRow(1, "santiago@google.com", "hash123", false, "totp", time.Now(), nil))
 
 	_, err = svc.SignIn(&dto.SignInDto{
 		Email:    "santiago@google.com",
 		Password: "santiago123",
-	})
+	}, "127.0.0.1")
 
 	if err == nil {
 		t.Errorf("Expected error %v, got nil", service.ErrInvalidPassword)
 	}
 
-	mock.ExpectPrepare("SELECT id, email, password FROM users WHERE email = ?")
-	mock.ExpectQuery("SELECT id, email, password FROM users WHERE email = ?").
+	mock.ExpectPrepare(regexp.QuoteMeta(mysql.GetUserByEmailQuery))
+	mock.ExpectQuery(regexp.QuoteMeta(mysql.GetUserByEmailQuery)).
 		WithArgs("santiago@google.com").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password"}).
-			AddRow(1, "santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK"))
+		WillReturnRows(userByEmailRows().
+			AddRow(1, "santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", false, "totp", time.Now(), nil))
+	mock.ExpectPrepare(regexp.QuoteMeta(mysql.SaveRefreshTokenQuery)).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	token, err := svc.SignIn(&dto.SignInDto{
+	tokens, err := svc.SignIn(&dto.SignInDto{
 		Email:    "santiago@google.com",
 		Password: "santiago123",
-	})
+	}, "127.0.0.1")
 
 	if err != nil {
 		t.Errorf("unxpected error: %v", err)
 	}
 
-	if len(token) == 0 {
+	if tokens == nil || len(tokens.AccessToken) == 0 {
 		t.Errorf("token should not be empty")
 	}
+	if tokens != nil && len(tokens.RefreshToken) == 0 {
+		t.Errorf("refresh token should not be empty")
+	}
+}
+
+func TestSignInWith2FA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("santiago@google.com").
+		WillReturnRows(userByEmailRows().
+			AddRow(1, "santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", true, "totp", time.Now(), nil))
+
+	tokens, err := svc.SignIn(&dto.SignInDto{
+		Email:    "santiago@google.com",
+		Password: "santiago123",
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unxpected error: %v", err)
+	}
+	if tokens.AccessToken != "" {
+		t.Error("access token should not be issued before the OTP is validated")
+	}
+	if !tokens.MFARequired || len(tokens.MFAToken) == 0 {
+		t.Error("expected an mfa pending token")
+	}
+
+	var claims model.Claims
+	_, err = jwt.ParseWithClaims(tokens.MFAToken, &claims, testKeys.Keyfunc, jwt.WithValidMethods(testKeys.Methods()))
+	if err != nil {
+		t.Fatalf("unexpected error parsing token: %v", err)
+	}
+	if claims.Scope != model.ScopeMFAPending {
+		t.Errorf("expected scope %q, got %q", model.ScopeMFAPending, claims.Scope)
+	}
 }
 
 func TestGenerateAccessToken(t *testing.T) {
@@ -62,10 +209,9 @@ func TestGenerateAccessToken(t *testing.T) {
 		t.Error(err)
 	}
 	defer db.Close()
-	repo := mysql.NewUserRepository(db)
-	svc := service.NewAuthService(repo)
+	svc := newAuthService(db)
 
-	token, err := svc.GenerateAccessToken("1")
+	token, err := svc.GenerateAccessToken("1", "session1", []string{model.AMRPassword}, time.Now())
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -81,8 +227,7 @@ func TestSaveUser(t *testing.T) {
 		t.Error(err)
 	}
 	defer db.Close()
-	repo := mysql.NewUserRepository(db)
-	svc := service.NewAuthService(repo)
+	svc := newAuthService(db)
 
 	mock.ExpectPrepare("INSERT INTO users (first_name, last_name, email, password) VALUES (?, ?, ?, ?)").
 		ExpectExec().
@@ -93,7 +238,7 @@ func TestSaveUser(t *testing.T) {
 		FirstName: "santiago",
 		LastName:  "bedoya",
 		Email:     "santiago@google.com",
-		Password:  "santiago123",
+		Password:  "correct horse battery",
 	})
 
 	if err != nil {
@@ -115,7 +260,7 @@ func TestSaveUser(t *testing.T) {
 		FirstName: "santiago",
 		LastName:  "bedoya",
 		Email:     "santiago@google.com",
-		Password:  "santiago123",
+		Password:  "correct horse battery",
 	})
 
 	if user != nil {
@@ -133,43 +278,109 @@ func TestSaveUser(t *testing.T) {
 	}
 }
 
-func TestSetUser2FAValid(t *testing.T) {
+func TestSetup2FA(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 	defer db.Close()
-	repo := mysql.NewUserRepository(db)
-	svc := service.NewAuthService(repo)
+	svc := newAuthService(db)
 
-	mock.ExpectPrepare(mysql.SetValidSecretQuery).
+	var sealed capturedArg
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.DeletePendingFactorsQuery).
 		ExpectExec().
 		WithArgs("1").
-		WillReturnResult(sqlmock.NewResult(0, 1))
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(mysql.SaveFactorQuery).
+		ExpectExec().
+		WithArgs(int64(1), "totp", "Phone", &sealed, "SHA1", 6, 30, 0, false, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = svc.SetUser2FAValid("1")
+	key, err := svc.Setup2FA("1", &dto.TOTPOptionsDto{Name: " Phone "})
 	if err != nil {
-		t.Errorf("Unexpected error: %v", err)
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sealed.value == "" || strings.Contains(sealed.value, key.Secret()) {
+		t.Fatalf("the secret should be stored encrypted, got %q", sealed.value)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// The ciphertext is bound to the user it was stored for.
+	repo := mysql.NewFactorRepository(db, newKeyring())
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", sealed.value, "SHA1", 6, 30, 0, 0, false, time.Now(), nil))
+
+	factors, err := repo.GetByUserID("1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(factors) != 1 || factors[0].Secret != key.Secret() {
+		t.Errorf("expected the pending factor with the enrolled secret, got %+v", factors)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("2").
+		WillReturnRows(factorRows().
+			AddRow(2, 2, "totp", "Phone", sealed.value, "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+
+	if _, err := repo.GetByUserID("2"); err == nil {
+		t.Error("expected an error decrypting a secret copied from another user")
 	}
 }
 
-func TestSetUser2FA(t *testing.T) {
+func TestSetup2FAWithOptions(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 	defer db.Close()
-	repo := mysql.NewUserRepository(db)
-	svc := service.NewAuthService(repo)
+	svc := newAuthService(db)
+
+	for _, options := range []dto.TOTPOptionsDto{{Algorithm: "MD5"}, {Digits: 7}, {Period: 45}} {
+		mock.ExpectPrepare(mysql.GetUserByIDQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(userByIDRows().
+				AddRow("santiago@google.com", "hash123", false, "", nil, false, time.Now(), nil))
+		if _, err := svc.Setup2FA("1", &options); !errors.Is(err, service.ErrInvalidTOTPParams) {
+			t.Errorf("%+v: expected error: %v, got %v", options, service.ErrInvalidTOTPParams, err)
+		}
+	}
 
-	mock.ExpectPrepare(mysql.SaveUserSecretQuery).
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.DeletePendingFactorsQuery).
 		ExpectExec().
-		WithArgs("secret123", "1").
-		WillReturnResult(sqlmock.NewResult(0, 1))
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(mysql.SaveFactorQuery).
+		ExpectExec().
+		WithArgs(int64(1), "totp", "Authenticator app", sqlmock.AnyArg(), "SHA256", 8, 60, 0, false, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = svc.SetUser2FA("1", "secret123")
+	key, err := svc.Setup2FA("1", &dto.TOTPOptionsDto{Algorithm: "sha256", Digits: 8, Period: 60})
 	if err != nil {
-		t.Errorf("Unexpected error: %v", err)
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if key.Algorithm() != otp.AlgorithmSHA256 || key.Digits() != otp.DigitsEight || key.Period() != 60 {
+		t.Errorf("expected the key to carry the options, got %s", key.URL())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
 	}
 }
 
@@ -179,14 +390,13 @@ func TestGetUserByID(t *testing.T) {
 		t.Error(err)
 	}
 	defer db.Close()
-	repo := mysql.NewUserRepository(db)
-	svc := service.NewAuthService(repo)
+	svc := newAuthService(db)
 
 	mock.ExpectPrepare(mysql.GetUserByIDQuery).
 		ExpectQuery().
 		WithArgs("1").
-		WillReturnRows(sqlmock.NewRows([]string{"email", "secret_2fa"}).
-			AddRow("santiago@google.com", "secret123"))
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "sms", "+14155550123", true, time.Now(), nil))
 
 	user, err := svc.GetUserByID("1")
 	if err != nil {
@@ -200,7 +410,368 @@ func TestGetUserByID(t *testing.T) {
 		t.Errorf("Expected user email 'santiago@google.com', got %v", user.Email)
 	}
 
-	if user != nil && user.Secret2FA != "secret123" {
-		t.Errorf("Expected user secret 2FA 'secret123', got %v", user.Secret2FA)
+	if user != nil && (user.MFAMethod != model.MFAMethodSMS || user.Phone != "+14155550123") {
+		t.Errorf("Expected the SMS factor, got %v %v", user.MFAMethod, user.Phone)
+	}
+}
+
+func TestSetup2FAWhenAlreadyEnabled(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+
+	_, err = svc.Setup2FA("1", &dto.TOTPOptionsDto{})
+	if !errors.Is(err, service.ErrMFAAlreadyEnabled) {
+		t.Errorf("expected error: %v, got %v", service.ErrMFAAlreadyEnabled, err)
+	}
+}
+
+func TestValidate2FAConfirmsPendingFactor(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second authenticator: the first one stays and no new recovery
+	// codes are issued.
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", "OLDSECRET", "SHA1", 6, 30, 0, 0, true, time.Now(), nil).
+			AddRow(2, 1, "totp", "Tablet", key.Secret(), "SHA1", 6, 30, 0, 0, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.ActivateFactorQuery).
+		ExpectExec().
+		WithArgs(2, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.Enable2FAQuery).
+		ExpectExec().
+		WithArgs("totp", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	tokens, err := svc.Validate2FA("1", &dto.OTPDto{Code: code}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens.RecoveryCodes) != 0 {
+		t.Error("recovery codes should only be issued on the first enrollment")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate2FAAcceptsAnyActiveFactor(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	phone, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tablet, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(tablet.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", phone.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil).
+			AddRow(2, 1, "hotp", "Key fob", hotpSecret, "SHA1", 6, 30, 0, 0, true, time.Now(), nil).
+			AddRow(3, 1, "totp", "Tablet", tablet.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if _, err := svc.Validate2FA("1", &dto.OTPDto{Code: code}, "127.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDisable2FA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK"
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", hash, true, "totp", nil, false, time.Now(), nil))
+
+	err = svc.Disable2FA("1", &dto.VerifyIdentityDto{Password: "wrong", Code: code}, "127.0.0.1")
+	if !errors.Is(err, service.ErrInvalidPassword) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidPassword, err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", hash, true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.Disable2FAQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.DeleteUserFactorsQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.DeleteUserWebAuthnCredentialsQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.DeleteUserTrustedDevicesQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectBegin()
+	mock.ExpectExec(mysql.DeleteRecoveryCodesQuery).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectPrepare(mysql.SaveRecoveryCodeQuery)
+	mock.ExpectCommit()
+
+	err = svc.Disable2FA("1", &dto.VerifyIdentityDto{Password: "santiago123", Code: code}, "127.0.0.1")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyIdentityIsThrottled(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUser := func() {
+		mock.ExpectPrepare(mysql.GetUserByIDQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(userByIDRows().
+				AddRow("santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", true, "totp", nil, false, time.Now(), nil))
+	}
+	data := &dto.VerifyIdentityDto{Password: "santiago123", Code: "000000"}
+
+	for i := 0; i < config.DefaultLockout().AccountThreshold; i++ {
+		expectUser()
+		mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(factorRows().
+				AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+		if err := svc.Disable2FA("1", data, "127.0.0.1"); !errors.Is(err, service.ErrInvalidPasscode) {
+			t.Fatalf("attempt %d: expected error: %v, got %v", i+1, service.ErrInvalidPasscode, err)
+		}
+	}
+
+	// Locked out, the code is not even checked.
+	expectUser()
+	if err := svc.Disable2FA("1", data, "127.0.0.1"); !errors.Is(err, service.ErrAccountLocked) {
+		t.Errorf("expected error: %v, got %v", service.ErrAccountLocked, err)
+	}
+	expectUser()
+	if _, err := svc.RegenerateRecoveryCodes("1", &dto.OTPDto{Code: "000000"}, "127.0.0.1"); !errors.Is(err, service.ErrAccountLocked) {
+		t.Errorf("expected error: %v, got %v", service.ErrAccountLocked, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate2FARejectsReplayedCode(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := totp.GenerateCode(key.Secret(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stepAt := now.Unix() / 30 * 30
+
+	// The code's time-step was already accepted.
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, stepAt, true, time.Now(), nil))
+
+	_, err = svc.Validate2FA("1", &dto.OTPDto{Code: code}, "127.0.0.1")
+	if !errors.Is(err, service.ErrPasscodeReused) {
+		t.Errorf("expected error: %v, got %v", service.ErrPasscodeReused, err)
+	}
+
+	// Another instance accepted the code between the read and the write.
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, stepAt-150, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = svc.Validate2FA("1", &dto.OTPDto{Code: code}, "127.0.0.1")
+	if !errors.Is(err, service.ErrInvalidPasscode) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidPasscode, err)
+	}
+}
+
+func TestValidate2FAWithEnrolledParams(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	opts := totp.ValidateOpts{Period: 60, Digits: otp.DigitsEight, Algorithm: otp.AlgorithmSHA256}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      "otp-api",
+		AccountName: "santiago@google.com",
+		Period:      opts.Period,
+		Digits:      opts.Digits,
+		Algorithm:   opts.Algorithm,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCodeCustom(key.Secret(), time.Now(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA256", 8, 60, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	_, err = svc.Validate2FA("1", &dto.OTPDto{Code: code}, "127.0.0.1")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
 	}
 }
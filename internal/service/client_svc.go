@@ -0,0 +1,137 @@
+package service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+type OAuthClientRepository interface {
+	GetByID(clientID string) (*model.OAuthClient, error)
+	Save(c *model.OAuthClient) error
+}
+
+// OAuthError is an error response as defined by RFC 6749, Code is sent as
+// the error parameter.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+var (
+	ErrInvalidClient           = &OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+	ErrInvalidRedirectURI      = &OAuthError{Code: "invalid_request", Description: "redirect_uri is not valid for the client"}
+	ErrInvalidOAuthRequest     = &OAuthError{Code: "invalid_request", Description: "invalid request"}
+	ErrInvalidGrant            = &OAuthError{Code: "invalid_grant", Description: "authorization grant is invalid or expired"}
+	ErrInvalidScope            = &OAuthError{Code: "invalid_scope", Description: "scope must include openid"}
+	ErrUnsupportedGrantType    = &OAuthError{Code: "unsupported_grant_type", Description: "grant type is not supported"}
+	ErrUnsupportedResponseType = &OAuthError{Code: "unsupported_response_type", Description: "response type is not supported"}
+)
+
+type ClientService struct {
+	repo OAuthClientRepository
+}
+
+func NewClientService(repo OAuthClientRepository) *ClientService {
+	return &ClientService{
+		repo: repo,
+	}
+}
+
+// Register creates a client and returns its secret, which is only stored
+// hashed. Public clients get no secret. Resource servers that only
+// introspect tokens can be registered without redirect URIs.
+func (s *ClientService) Register(name string, redirectURIs []string, public bool) (*model.OAuthClient, string, error) {
+	if public && len(redirectURIs) == 0 {
+		return nil, "", ErrInvalidRedirectURI
+	}
+	for _, uri := range redirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, "", err
+		}
+	}
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &model.OAuthClient{
+		ID:           id,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+	}
+	var secret string
+	if !public {
+		secret, err = randomToken(32)
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+	if err := s.repo.Save(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+func (s *ClientService) GetClient(clientID string) (*model.OAuthClient, error) {
+	if clientID == "" {
+		return nil, ErrInvalidClient
+	}
+	return s.repo.GetByID(clientID)
+}
+
+// Authenticate checks the client secret of confidential clients. Public
+// clients must not send one.
+func (s *ClientService) Authenticate(clientID, secret string) (*model.OAuthClient, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic() {
+		if secret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// RedirectURI returns uri when it exactly matches one of the registered
+// URIs. Prefix or pattern matching is not supported on purpose.
+func (s *ClientService) RedirectURI(client *model.OAuthClient, uri string) (string, error) {
+	for _, registered := range client.RedirectURIs {
+		if registered == uri {
+			return uri, nil
+		}
+	}
+	return "", ErrInvalidRedirectURI
+}
+
+// validateRedirectURI only accepts absolute https URIs without fragment,
+// plain http is allowed for loopback addresses during development.
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("%w: %q", ErrInvalidRedirectURI, uri)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q must use https", ErrInvalidRedirectURI, uri)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// otpCodeDigits is the length of the codes delivered by email or SMS.
+const otpCodeDigits = 6
+
+// deliveredOTP is a code sent by email or by SMS.
+type deliveredOTP interface {
+	Delivered() *model.DeliveredCode
+}
+
+// deliveredCodeRepository is what EmailOTPRepository and SMSOTPRepository
+// have in common.
+type deliveredCodeRepository[T deliveredOTP] interface {
+	Save(code T) error
+	GetLatest(userID string) (T, error)
+	MarkUsed(id int64) error
+}
+
+// codeDelivery sends one-time codes over one channel and checks them.
+type codeDelivery[T deliveredOTP] struct {
+	repo           deliveredCodeRepository[T]
+	ttl            time.Duration
+	resendInterval time.Duration
+}
+
+// deliver stores code with a new hashed code and hands the plain code to
+// send. It waits resendInterval between codes, unless the last one has
+// already been used.
+func (d codeDelivery[T]) deliver(userID string, code T, send func(plain string) error) error {
+	latest, err := d.repo.GetLatest(userID)
+	if err != nil && !errors.Is(err, ErrInvalidPasscode) {
+		return err
+	}
+	now := time.Now()
+	if err == nil && latest.Delivered().UsedAt == nil {
+		if wait := d.resendInterval - now.Sub(latest.Delivered().CreatedAt); wait > 0 {
+			return &LockoutError{RetryAfter: wait}
+		}
+	}
+	plain, err := newOTPCode()
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return err
+	}
+	c := code.Delivered()
+	c.UserID = id
+	c.CodeHash = string(hash)
+	c.ExpiresAt = now.Add(d.ttl)
+	c.CreatedAt = now
+	if err := d.repo.Save(code); err != nil {
+		return err
+	}
+	return send(plain)
+}
+
+// check validates code against the last code sent to the user and marks it
+// as used. An empty purpose accepts any purpose.
+func (d codeDelivery[T]) check(userID, purpose, code string) (T, error) {
+	var none T
+	latest, err := d.repo.GetLatest(userID)
+	if err != nil {
+		return none, err
+	}
+	c := latest.Delivered()
+	if c.UsedAt != nil || time.Now().After(c.ExpiresAt) || (purpose != "" && c.Purpose != purpose) {
+		return none, ErrInvalidPasscode
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(c.CodeHash), []byte(code)); err != nil {
+		return none, ErrInvalidPasscode
+	}
+	if err := d.repo.MarkUsed(c.ID); err != nil {
+		return none, err
+	}
+	return latest, nil
+}
+
+func newOTPCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpCodeDigits, n), nil
+}
@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The email and SMS codes share their delivery and checks, these tests go
+// through email.
+
+func TestDeliverCodeResendInterval(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		latest *sqlmock.Rows
+		wait   bool
+	}{
+		{"first code", emailOTPRows(), false},
+		{"unused code", emailOTPRows().AddRow(5, 1, "hash", "verify", now.Add(time.Minute), nil, now.Add(-10*time.Second)), true},
+		{"used code", emailOTPRows().AddRow(5, 1, "hash", "verify", now.Add(time.Minute), now, now.Add(-10*time.Second)), false},
+		{"old code", emailOTPRows().AddRow(5, 1, "hash", "verify", now.Add(time.Minute), nil, now.Add(-time.Hour)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("error opening stub db connection: %v", err)
+			}
+			defer db.Close()
+			svc := newAuthService(db)
+
+			mock.ExpectPrepare(mysql.GetUserByIDQuery).
+				ExpectQuery().
+				WithArgs("1").
+				WillReturnRows(userByIDRows().
+					AddRow("santiago@google.com", "hash123", true, "email", nil, false, time.Now(), nil))
+			mock.ExpectPrepare(mysql.GetLatestEmailOTPQuery).
+				ExpectQuery().
+				WithArgs("1").
+				WillReturnRows(tt.latest)
+			var hash capturedArg
+			if !tt.wait {
+				mock.ExpectPrepare(mysql.SaveEmailOTPQuery).
+					ExpectExec().
+					WithArgs(int64(1), &hash, "verify", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(6, 1))
+			}
+
+			err = svc.RequestEmailOTP("1")
+			var lockoutErr *service.LockoutError
+			if tt.wait {
+				if !errors.As(err, &lockoutErr) || lockoutErr.RetryAfter <= 0 {
+					t.Errorf("expected a retry after the resend interval, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckDeliveredCode(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tests := []struct {
+		name    string
+		code    string
+		latest  *sqlmock.Rows
+		used    int64
+		wantErr error
+	}{
+		{"valid", "123456", emailOTPRows().AddRow(5, 1, string(hash), "verify", now.Add(time.Minute), nil, now), 1, nil},
+		{"wrong code", "654321", emailOTPRows().AddRow(5, 1, string(hash), "verify", now.Add(time.Minute), nil, now), -1, service.ErrInvalidPasscode},
+		{"expired", "123456", emailOTPRows().AddRow(5, 1, string(hash), "verify", now.Add(-time.Second), nil, now), -1, service.ErrInvalidPasscode},
+		{"used", "123456", emailOTPRows().AddRow(5, 1, string(hash), "verify", now.Add(time.Minute), now, now), -1, service.ErrInvalidPasscode},
+		{"enrollment code", "123456", emailOTPRows().AddRow(5, 1, string(hash), "enroll", now.Add(time.Minute), nil, now), -1, service.ErrInvalidPasscode},
+		{"none sent", "123456", emailOTPRows(), -1, service.ErrInvalidPasscode},
+		{"used concurrently", "123456", emailOTPRows().AddRow(5, 1, string(hash), "verify", now.Add(time.Minute), nil, now), 0, service.ErrInvalidPasscode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("error opening stub db connection: %v", err)
+			}
+			defer db.Close()
+			svc := newAuthService(db)
+
+			mock.ExpectPrepare(mysql.GetUserByIDQuery).
+				ExpectQuery().
+				WithArgs("1").
+				WillReturnRows(userByIDRows().
+					AddRow("santiago@google.com", "hash123", true, "email", nil, false, time.Now(), nil))
+			mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+				ExpectQuery().
+				WithArgs("1").
+				WillReturnRows(factorRows())
+			mock.ExpectPrepare(mysql.GetLatestEmailOTPQuery).
+				ExpectQuery().
+				WithArgs("1").
+				WillReturnRows(tt.latest)
+			if tt.used >= 0 {
+				mock.ExpectPrepare(mysql.MarkEmailOTPUsedQuery).
+					ExpectExec().
+					WithArgs(sqlmock.AnyArg(), 5).
+					WillReturnResult(sqlmock.NewResult(0, tt.used))
+			}
+			if tt.wantErr == nil {
+				mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+					ExpectExec().
+					WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			_, err = svc.Validate2FA("1", &dto.OTPDto{Code: tt.code}, "127.0.0.1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error: %v, got %v", tt.wantErr, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+type Mailer interface {
+	Send(msg *model.MailMessage) error
+}
+
+type EmailOTPRepository interface {
+	Save(code *model.EmailOTP) error
+	// GetLatest returns the last code sent to the user, older codes are no
+	// longer valid once a new one is sent.
+	GetLatest(userID string) (*model.EmailOTP, error)
+	MarkUsed(id int64) error
+}
+
+// EnrollEmail2FA sends a code to the user's address. Email becomes the
+// second factor once that code is verified. Users that already have 2FA
+// must prove their identity first.
+func (s *AuthService) EnrollEmail2FA(userID string, data *dto.VerifyIdentityDto, clientIP string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireVerifiedEmail(user, config.EmailVerificationEnrollment); err != nil {
+		return err
+	}
+	if user.Valid2FA {
+		if user.MFAMethod == model.MFAMethodEmail {
+			return ErrMFAAlreadyEnabled
+		}
+		if err := s.verifyIdentity(userID, clientIP, user, data); err != nil {
+			return err
+		}
+	}
+	return s.sendEmailOTP(userID, user.Email, model.OTPEnroll)
+}
+
+// RequestEmailOTP sends a sign-in code to users whose second factor is
+// email.
+func (s *AuthService) RequestEmailOTP(userID string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.Valid2FA || user.MFAMethod != model.MFAMethodEmail {
+		return ErrEmailOTPNotEnabled
+	}
+	return s.sendEmailOTP(userID, user.Email, model.OTPVerify)
+}
+
+// VerifyEmailOTP confirms an email enrollment or completes a sign-in with
+// an emailed code.
+func (s *AuthService) VerifyEmailOTP(userID string, data *dto.OTPDto, clientIP string) (*dto.TokenDto, error) {
+	return s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+		user, err := s.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		code, err := s.checkEmailOTP(userID, "", data.Code)
+		if err != nil {
+			return nil, err
+		}
+		if code.Purpose == model.OTPEnroll {
+			return s.confirm2FA(userID, user, func(userID string) error {
+				return s.repo.Enable2FA(userID, model.MFAMethodEmail)
+			})
+		}
+		if !user.Valid2FA || user.MFAMethod != model.MFAMethodEmail {
+			return nil, ErrInvalidPasscode
+		}
+		return s.issueTokens(userID, "", mfaAMR, time.Now())
+	})
+}
+
+func (s *AuthService) emailCodes() codeDelivery[*model.EmailOTP] {
+	return codeDelivery[*model.EmailOTP]{
+		repo:           s.emailOTPs,
+		ttl:            s.emailCfg.TTL,
+		resendInterval: s.emailCfg.ResendInterval,
+	}
+}
+
+func (s *AuthService) sendEmailOTP(userID, email, purpose string) error {
+	code := &model.EmailOTP{DeliveredCode: model.DeliveredCode{Purpose: purpose}}
+	return s.emailCodes().deliver(userID, code, func(plain string) error {
+		return s.mailer.Send(&model.MailMessage{
+			To:      email,
+			Subject: fmt.Sprintf("Your %s verification code", s.totpCfg.Issuer),
+			Body: fmt.Sprintf("Your verification code is %s.\n\nIt expires in %d minutes. If you did not request it, you can ignore this email.\n",
+				plain, int(s.emailCfg.TTL.Minutes())),
+		})
+	})
+}
+
+func (s *AuthService) checkEmailOTP(userID, purpose, code string) (*model.EmailOTP, error) {
+	return s.emailCodes().check(userID, purpose, code)
+}
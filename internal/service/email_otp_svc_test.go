@@ -0,0 +1,108 @@
+package service_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func emailOTPRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "code_hash", "purpose", "expires_at", "used_at", "created_at"})
+}
+
+func TestEnrollEmail2FA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	var hash capturedArg
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetLatestEmailOTPQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(emailOTPRows())
+	mock.ExpectPrepare(mysql.SaveEmailOTPQuery).
+		ExpectExec().
+		WithArgs(int64(1), &hash, "enroll", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+
+	if err := svc.EnrollEmail2FA("1", &dto.VerifyIdentityDto{}, "127.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	msg := testMailer.Last()
+	if msg == nil || msg.To != "santiago@google.com" {
+		t.Fatalf("expected a code to be mailed to the user, got %+v", msg)
+	}
+	code := regexp.MustCompile(`\d{6}`).FindString(msg.Body)
+	if bcrypt.CompareHashAndPassword([]byte(hash.value), []byte(code)) != nil {
+		t.Fatalf("the mailed code %q does not match the stored hash", code)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetLatestEmailOTPQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(emailOTPRows().
+			AddRow(5, 1, hash.value, "enroll", time.Now().Add(time.Minute), nil, time.Now()))
+	mock.ExpectPrepare(mysql.MarkEmailOTPUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.Enable2FAQuery).
+		ExpectExec().
+		WithArgs("email", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectFirstRecoveryCodes(mock)
+
+	tokens, err := svc.VerifyEmailOTP("1", &dto.OTPDto{Code: code}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens.AccessToken) == 0 || len(tokens.RecoveryCodes) != 10 {
+		t.Errorf("expected tokens and recovery codes, got %+v", tokens)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestEmailOTPNotEnabled(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+
+	if err := svc.RequestEmailOTP("1"); !errors.Is(err, service.ErrEmailOTPNotEnabled) {
+		t.Errorf("expected error: %v, got %v", service.ErrEmailOTPNotEnabled, err)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SendVerificationEmail mails a signed link that confirms the address of a
+// user who just signed up.
+func (s *AuthService) SendVerificationEmail(user *model.User) error {
+	now := time.Now()
+	token, err := s.keys.Sign(model.EmailVerificationClaims{
+		Scope: model.ScopeVerifyEmail,
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "otp-api",
+			Subject:   fmt.Sprint(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.verifyCfg.TTL)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(s.verifyCfg.URL, token)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetEmailVerificationSent(fmt.Sprint(user.ID), now); err != nil {
+		return err
+	}
+	return s.mailer.Send(&model.MailMessage{
+		To:      user.Email,
+		Subject: fmt.Sprintf("Verify your %s email address", s.totpCfg.Issuer),
+		Body: fmt.Sprintf("Open the link below to verify your email address:\n\n%s\n\nIt expires in %d hours. If you did not sign up, you can ignore this email.\n",
+			link, int(s.verifyCfg.TTL.Hours())),
+	})
+}
+
+// ResendVerificationEmail sends a new link to an unverified address.
+// Unknown or verified addresses and requests within ResendInterval are
+// ignored without an error, so the response does not tell whether an
+// account exists.
+func (s *AuthService) ResendVerificationEmail(data *dto.ResendVerificationDto) error {
+	user, err := s.repo.GetByEmail(data.Email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	if sent := user.EmailVerificationSentAt; sent != nil && time.Since(*sent) < s.verifyCfg.ResendInterval {
+		return nil
+	}
+	return s.SendVerificationEmail(user)
+}
+
+// VerifyEmail confirms the address with the token of a verification link.
+// Links sent to an address the user has since changed are rejected.
+func (s *AuthService) VerifyEmail(data *dto.VerifyEmailDto) error {
+	var claims model.EmailVerificationClaims
+	parsed, err := jwt.ParseWithClaims(data.Token, &claims, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.Methods()))
+	if err != nil || !parsed.Valid || claims.Scope != model.ScopeVerifyEmail {
+		return ErrInvalidVerificationToken
+	}
+	user, err := s.GetUserByID(claims.Subject)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+	if user.Email != claims.Email {
+		return ErrInvalidVerificationToken
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.repo.MarkEmailVerified(claims.Subject, claims.Email)
+}
+
+// requireVerifiedEmail fails for users with an unverified address when the
+// policy blocks step, config.EmailVerificationEnrollment or
+// config.EmailVerificationSignIn.
+func (s *AuthService) requireVerifiedEmail(user *model.User, step string) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	switch s.verifyCfg.Policy {
+	case config.EmailVerificationSignIn:
+		return ErrEmailNotVerified
+	case config.EmailVerificationEnrollment:
+		if step == config.EmailVerificationEnrollment {
+			return ErrEmailNotVerified
+		}
+	}
+	return nil
+}
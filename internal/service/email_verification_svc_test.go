@@ -0,0 +1,138 @@
+package service_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.SetEmailVerificationSentQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = svc.SendVerificationEmail(&model.User{ID: 1, Email: "santiago@google.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := testMailer.Last()
+	if msg == nil || msg.To != "santiago@google.com" {
+		t.Fatalf("expected a verification link to be mailed to the user, got %+v", msg)
+	}
+	token := regexp.MustCompile(`token=([\w.-]+)`).FindStringSubmatch(msg.Body)
+	if token == nil {
+		t.Fatalf("no verification link in %q", msg.Body)
+	}
+
+	if err := svc.VerifyEmail(&dto.VerifyEmailDto{Token: "not-a-token"}); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidVerificationToken, err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@yahoo.com", "hash123", false, "totp", nil, false, nil, time.Now()))
+	if err := svc.VerifyEmail(&dto.VerifyEmailDto{Token: token[1]}); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Errorf("a link sent to a previous address should be rejected, got %v", err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, nil, time.Now()))
+	mock.ExpectPrepare(mysql.MarkEmailVerifiedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1", "santiago@google.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.VerifyEmail(&dto.VerifyEmailDto{Token: token[1]}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	expectUser := func(verifiedAt, sentAt any) {
+		mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+			ExpectQuery().
+			WithArgs("santiago@google.com").
+			WillReturnRows(userByEmailRows().
+				AddRow(1, "santiago@google.com", "hash123", false, "totp", verifiedAt, sentAt))
+	}
+	data := &dto.ResendVerificationDto{Email: "santiago@google.com"}
+	sent := len(testMailer.Messages())
+
+	expectUser(time.Now(), nil)
+	if err := svc.ResendVerificationEmail(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectUser(nil, time.Now())
+	if err := svc.ResendVerificationEmail(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(testMailer.Messages()) != sent {
+		t.Fatal("no email should be sent to a verified address or within the resend interval")
+	}
+
+	expectUser(nil, time.Now().Add(-time.Hour))
+	mock.ExpectPrepare(mysql.SetEmailVerificationSentQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.ResendVerificationEmail(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(testMailer.Messages()) != sent+1 {
+		t.Error("expected a new verification email")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetup2FARequiresVerifiedEmail(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, nil, time.Now()))
+
+	if _, err := svc.Setup2FA("1", &dto.TOTPOptionsDto{}); !errors.Is(err, service.ErrEmailNotVerified) {
+		t.Errorf("expected error: %v, got %v", service.ErrEmailNotVerified, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,10 +1,53 @@
 package service
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrEmailInUse      = errors.New("email is already in use")
-	ErrInvalidPassword = errors.New("password does not match")
-	ErrUserNotFound    = errors.New("user is not found")
-	ErrInvalidPasscode = errors.New("invalid passcode")
+	ErrEmailInUse               = errors.New("email is already in use")
+	ErrInvalidPassword          = errors.New("password does not match")
+	ErrUserNotFound             = errors.New("user is not found")
+	ErrInvalidPasscode          = errors.New("invalid passcode")
+	ErrInvalidRefreshToken      = errors.New("refresh token is invalid")
+	ErrRefreshTokenReused       = errors.New("refresh token has already been used")
+	ErrInvalidRecoveryCode      = errors.New("invalid recovery code")
+	ErrMFANotEnabled            = errors.New("2FA is not enabled")
+	ErrMFAAlreadyEnabled        = errors.New("2FA is already enabled")
+	ErrPasscodeReused           = fmt.Errorf("%w: it has already been used", ErrInvalidPasscode)
+	ErrTooManyAttempts          = errors.New("too many failed attempts, try again later")
+	ErrAccountLocked            = errors.New("account is temporarily locked")
+	ErrMFARequired              = errors.New("2FA code is required")
+	ErrEmailOTPNotEnabled       = errors.New("email OTP is not enabled")
+	ErrSMSOTPNotEnabled         = errors.New("SMS OTP is not enabled")
+	ErrInvalidCredential        = errors.New("security key or passkey is not valid")
+	ErrCredentialInUse          = errors.New("security key or passkey is already registered")
+	ErrCredentialCloned         = fmt.Errorf("%w: its signature counter went backwards", ErrInvalidCredential)
+	ErrNoWebAuthnCredentials    = errors.New("no security key or passkey is registered")
+	ErrInvalidWebAuthnChallenge = errors.New("WebAuthn challenge is invalid or has expired")
+	ErrSecurityKeyUnsupported   = errors.New("security keys cannot be used on this sign-in form, use a recovery code")
+	ErrInvalidPhone             = errors.New("phone number must be in international format, e.g. +14155550123")
+	ErrHOTPNotEnabled           = errors.New("HOTP is not enabled")
+	ErrInvalidHOTPSecret        = errors.New("HOTP secret must be base32 encoded")
+	ErrHOTPNotSynchronized      = fmt.Errorf("%w: codes are not consecutive codes of the fob", ErrInvalidPasscode)
+	ErrFactorNotFound           = errors.New("authenticator is not found")
+	ErrInvalidFactorName        = errors.New("authenticator name must be between 1 and 64 characters")
+	ErrInvalidTOTPParams        = errors.New("TOTP algorithm must be SHA1, SHA256 or SHA512, digits 6 or 8 and period 30 or 60 seconds")
+	ErrInvalidDeviceToken       = errors.New("device token is invalid or has expired")
+	ErrTrustedDeviceNotFound    = errors.New("trusted device is not found")
+	ErrInvalidResetToken        = errors.New("password reset token is invalid or has expired")
+	ErrPasswordRequired         = errors.New("password is required")
+	ErrEmailNotVerified         = errors.New("email address is not verified")
+	ErrInvalidVerificationToken = errors.New("email verification link is invalid or has expired")
+	ErrInvalidEmail             = errors.New("email address is not valid")
+	ErrWeakPassword             = errors.New("password does not meet the password policy")
+	ErrPasswordTooShort         = errors.New("it is too short")
+	ErrPasswordTooLong          = errors.New("it is too long")
+	ErrPasswordNoLower          = errors.New("it needs a lowercase letter")
+	ErrPasswordNoUpper          = errors.New("it needs an uppercase letter")
+	ErrPasswordNoDigit          = errors.New("it needs a digit")
+	ErrPasswordNoSymbol         = errors.New("it needs a symbol")
+	ErrPasswordPersonalInfo     = errors.New("it must not contain your email or name")
+	ErrPasswordBreached         = errors.New("it appeared in a data breach, choose another one")
 )
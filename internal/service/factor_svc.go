@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+const maxFactorNameLength = 64
+
+type FactorRepository interface {
+	Save(factor *model.Factor) error
+	// GetByUserID returns the active and pending factors of the user,
+	// oldest first.
+	GetByUserID(userID string) ([]*model.Factor, error)
+	Activate(userID string, id int64) error
+	Rename(userID string, id int64, name string) error
+	Delete(userID string, id int64) error
+	DeletePending(userID string) error
+	DeleteAll(userID string) error
+	SetLastOTPAt(id int64, stepAt int64) error
+	SetCounter(id int64, previous, counter uint64) error
+}
+
+// ListFactors returns the active authenticator apps, HOTP fobs and
+// security keys of the user. Security keys are stored in their own table,
+// so an id only identifies a factor together with its type.
+func (s *AuthService) ListFactors(userID string) ([]dto.FactorDto, error) {
+	factors, err := s.factors.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := s.credentials.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]dto.FactorDto, 0, len(factors)+len(creds))
+	for _, f := range factors {
+		if !f.Active {
+			continue
+		}
+		list = append(list, dto.FactorDto{
+			ID:         f.ID,
+			Type:       f.Type,
+			Name:       f.Name,
+			CreatedAt:  f.CreatedAt,
+			LastUsedAt: f.LastUsedAt,
+		})
+	}
+	for _, c := range creds {
+		list = append(list, dto.FactorDto{
+			ID:         c.ID,
+			Type:       model.MFAMethodWebAuthn,
+			Name:       c.Name,
+			CreatedAt:  c.CreatedAt,
+			LastUsedAt: c.LastUsedAt,
+		})
+	}
+	return list, nil
+}
+
+// RenameFactor renames a security key when factorType is webauthn and an
+// authenticator app or HOTP fob otherwise.
+func (s *AuthService) RenameFactor(userID, factorType string, id int64, data *dto.RenameFactorDto) error {
+	name, err := factorName(data.Name, "")
+	if err != nil {
+		return err
+	}
+	if factorType == model.MFAMethodWebAuthn {
+		creds, err := s.credentials.GetByUserID(userID)
+		if err != nil {
+			return err
+		}
+		if findCredential(creds, id) == nil {
+			return ErrFactorNotFound
+		}
+		return s.credentials.Rename(userID, id, name)
+	}
+	factors, err := s.factors.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if activeFactor(factors, id) == nil {
+		return ErrFactorNotFound
+	}
+	return s.factors.Rename(userID, id, name)
+}
+
+// DeleteFactor removes a security key when factorType is webauthn and an
+// authenticator app or HOTP fob otherwise, after the user proves their
+// identity. Deleting the last factor the user signs in with switches them
+// to another one, or turns 2FA off when none is left.
+func (s *AuthService) DeleteFactor(userID, factorType string, id int64, data *dto.VerifyIdentityDto, clientIP string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyIdentity(userID, clientIP, user, data); err != nil {
+		return err
+	}
+	factors, err := s.factors.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+	creds, err := s.credentials.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+	var (
+		deleted   string
+		remaining []string
+	)
+	for _, f := range factors {
+		if !f.Active {
+			continue
+		}
+		if factorType != model.MFAMethodWebAuthn && f.ID == id {
+			deleted = f.Type
+			continue
+		}
+		remaining = append(remaining, f.Type)
+	}
+	for _, c := range creds {
+		if factorType == model.MFAMethodWebAuthn && c.ID == id {
+			deleted = model.MFAMethodWebAuthn
+			continue
+		}
+		remaining = append(remaining, model.MFAMethodWebAuthn)
+	}
+	if deleted == "" {
+		return ErrFactorNotFound
+	}
+	if user.MFAMethod == deleted && !slices.Contains(remaining, deleted) {
+		if len(remaining) == 0 {
+			return s.turnOff2FA(userID)
+		}
+		if err := s.repo.Enable2FA(userID, remaining[0]); err != nil {
+			return err
+		}
+	}
+	if deleted == model.MFAMethodWebAuthn {
+		return s.credentials.Delete(userID, id)
+	}
+	return s.factors.Delete(userID, id)
+}
+
+// validateFactor accepts a code from any active authenticator app or HOTP
+// fob of the user.
+func (s *AuthService) validateFactor(factors []*model.Factor, code string) error {
+	for _, f := range factors {
+		if !f.Active {
+			continue
+		}
+		var err error
+		if f.Type == model.MFAMethodHOTP {
+			err = s.validateHOTP(f, code)
+		} else {
+			err = s.validateTOTP(f, code)
+		}
+		if !errors.Is(err, ErrInvalidPasscode) || errors.Is(err, ErrPasscodeReused) {
+			return err
+		}
+	}
+	return ErrInvalidPasscode
+}
+
+// activateFactor confirms a pending factor and makes its type the method
+// asked for at sign-in.
+func (s *AuthService) activateFactor(userID string, factor *model.Factor) error {
+	if err := s.factors.Activate(userID, factor.ID); err != nil {
+		return err
+	}
+	return s.repo.Enable2FA(userID, factor.Type)
+}
+
+func pendingFactor(factors []*model.Factor) *model.Factor {
+	for _, f := range factors {
+		if !f.Active {
+			return f
+		}
+	}
+	return nil
+}
+
+func activeFactor(factors []*model.Factor, id int64) *model.Factor {
+	for _, f := range factors {
+		if f.Active && f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+func findCredential(creds []*model.WebAuthnCredential, id int64) *model.WebAuthnCredential {
+	for _, c := range creds {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func hasFactorType(factors []*model.Factor, factorType string) bool {
+	for _, f := range factors {
+		if f.Type == factorType {
+			return true
+		}
+	}
+	return false
+}
+
+// factorName trims name and falls back to fallback when it is empty.
+func factorName(name, fallback string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = fallback
+	}
+	if name == "" || utf8.RuneCountInString(name) > maxFactorNameLength {
+		return "", ErrInvalidFactorName
+	}
+	return name, nil
+}
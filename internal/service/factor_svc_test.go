@@ -0,0 +1,226 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestListFactors(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	usedAt := time.Now().Add(-time.Hour)
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", "SECRET1", "SHA1", 6, 30, 0, 0, true, time.Now(), usedAt).
+			AddRow(2, 1, "hotp", "Key fob", "SECRET2", "SHA1", 6, 0, 3, 0, true, time.Now(), nil).
+			AddRow(3, 1, "totp", "Tablet", "SECRET3", "SHA1", 6, 30, 0, 0, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(1, 1, "YubiKey", []byte("credential"), []byte("key"), 0, "usb", time.Now(), nil))
+
+	factors, err := svc.ListFactors("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(factors) != 3 {
+		t.Fatalf("expected the 2 active factors and the security key, got %d", len(factors))
+	}
+	if factors[0].Name != "Phone" || factors[0].LastUsedAt == nil || factors[1].Type != "hotp" {
+		t.Errorf("unexpected factors: %+v", factors)
+	}
+	if factors[2].ID != 1 || factors[2].Type != "webauthn" || factors[2].Name != "YubiKey" {
+		t.Errorf("expected the security key to be listed with its type, got %+v", factors[2])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRenameFactor(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	if err := svc.RenameFactor("1", "totp", 1, &dto.RenameFactorDto{Name: "  "}); !errors.Is(err, service.ErrInvalidFactorName) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidFactorName, err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", "SECRET1", "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+
+	if err := svc.RenameFactor("1", "totp", 7, &dto.RenameFactorDto{Name: "Old phone"}); !errors.Is(err, service.ErrFactorNotFound) {
+		t.Errorf("expected error: %v, got %v", service.ErrFactorNotFound, err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", "SECRET1", "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.RenameFactorQuery).
+		ExpectExec().
+		WithArgs("Old phone", 1, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.RenameFactor("1", "totp", 1, &dto.RenameFactorDto{Name: "Old phone"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// The id of a security key is looked up among the security keys.
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(7, 1, "Security key", []byte("credential"), []byte("key"), 0, "usb", time.Now(), nil))
+	mock.ExpectPrepare(mysql.RenameWebAuthnCredentialQuery).
+		ExpectExec().
+		WithArgs("YubiKey", 7, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.RenameFactor("1", "webauthn", 7, &dto.RenameFactorDto{Name: "YubiKey"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteFactor(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK"
+	recoveryHash, err := bcrypt.GenerateFromPassword([]byte("abcdefghij"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting the only factor of a user turns 2FA off.
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", hash, true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows())
+	mock.ExpectPrepare(mysql.Disable2FAQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.DeleteUserFactorsQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.DeleteUserWebAuthnCredentialsQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(mysql.DeleteUserTrustedDevicesQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(mysql.DeleteRecoveryCodesQuery).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectPrepare(mysql.SaveRecoveryCodeQuery)
+	mock.ExpectCommit()
+
+	err = svc.DeleteFactor("1", "totp", 1, &dto.VerifyIdentityDto{Password: "santiago123", Code: code}, "127.0.0.1")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Deleting the last authenticator app leaves the fob to sign in with.
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", hash, true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUnusedRecoveryCodesQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "code_hash"}).
+			AddRow(3, 1, string(recoveryHash)))
+	mock.ExpectPrepare(mysql.MarkRecoveryCodeUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil).
+			AddRow(2, 1, "hotp", "Key fob", hotpSecret, "SHA1", 6, 0, 3, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows())
+	mock.ExpectPrepare(mysql.Enable2FAQuery).
+		ExpectExec().
+		WithArgs("hotp", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.DeleteFactorQuery).
+		ExpectExec().
+		WithArgs(1, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = svc.DeleteFactor("1", "totp", 1, &dto.VerifyIdentityDto{Password: "santiago123", RecoveryCode: "abcde-fghij"}, "127.0.0.1")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"encoding/base32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+)
+
+var hotpSecretReplacer = strings.NewReplacer(" ", "", "-", "", "=", "")
+
+// EnrollHOTP2FA adds an HOTP fob as a factor. The fob proves it holds
+// data.Secret with two consecutive codes, which also tells where its
+// counter is. Users that already have 2FA must prove their identity first.
+func (s *AuthService) EnrollHOTP2FA(userID string, data *dto.HOTPEnrollDto, clientIP string) (*dto.TokenDto, error) {
+	name, err := factorName(data.Name, "Key fob")
+	if err != nil {
+		return nil, err
+	}
+	secret := strings.ToUpper(hotpSecretReplacer.Replace(data.Secret))
+	if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret); err != nil || secret == "" {
+		return nil, ErrInvalidHOTPSecret
+	}
+	params := model.TOTPParams{
+		Algorithm: strings.ToUpper(data.Algorithm),
+		Digits:    data.Digits,
+	}
+	if params.Algorithm == "" {
+		params.Algorithm = "SHA1"
+	}
+	if params.Digits == 0 {
+		params.Digits = 6
+	}
+	switch params.Algorithm {
+	case "SHA1", "SHA256", "SHA512":
+	default:
+		return nil, ErrInvalidHOTPSecret
+	}
+	if params.Digits != 6 && params.Digits != 8 {
+		return nil, ErrInvalidHOTPSecret
+	}
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireVerifiedEmail(user, config.EmailVerificationEnrollment); err != nil {
+		return nil, err
+	}
+	if user.Valid2FA {
+		if err := s.verifyIdentity(userID, clientIP, user, &data.VerifyIdentityDto); err != nil {
+			return nil, err
+		}
+	}
+	next, ok := matchHOTPPair(&data.HOTPCodesDto, secret, params, data.Counter, s.hotpCfg.ResyncWindow)
+	if !ok {
+		return nil, ErrHOTPNotSynchronized
+	}
+	return s.confirm2FA(userID, user, func(userID string) error {
+		err := s.factors.Save(&model.Factor{
+			UserID:    id,
+			Type:      model.MFAMethodHOTP,
+			Name:      name,
+			Secret:    secret,
+			Params:    params,
+			Counter:   next,
+			Active:    true,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		return s.repo.Enable2FA(userID, model.MFAMethodHOTP)
+	})
+}
+
+// ResyncHOTP completes a sign-in with two consecutive codes of a fob that
+// was pressed too often to fall inside the look-ahead window, and moves
+// the stored counter of that fob past them.
+func (s *AuthService) ResyncHOTP(userID string, data *dto.HOTPCodesDto, clientIP string) (*dto.TokenDto, error) {
+	return s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+		factors, err := s.factors.GetByUserID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if !hasFactorType(factors, model.MFAMethodHOTP) {
+			return nil, ErrHOTPNotEnabled
+		}
+		for _, f := range factors {
+			if !f.Active || f.Type != model.MFAMethodHOTP {
+				continue
+			}
+			next, ok := matchHOTPPair(data, f.Secret, f.Params, f.Counter, s.hotpCfg.ResyncWindow)
+			if !ok {
+				continue
+			}
+			if err := s.factors.SetCounter(f.ID, f.Counter, next); err != nil {
+				return nil, err
+			}
+			return s.issueTokens(userID, "", mfaAMR, time.Now())
+		}
+		return nil, ErrHOTPNotSynchronized
+	})
+}
+
+// validateHOTP accepts a code generated for the stored counter or up to
+// LookAhead presses after it. The counter moves past the accepted code so
+// it, and every code before it, cannot be used again.
+func (s *AuthService) validateHOTP(factor *model.Factor, code string) error {
+	counter, ok := matchHOTP(code, factor.Secret, factor.Params, factor.Counter, s.hotpCfg.LookAhead)
+	if !ok {
+		return ErrInvalidPasscode
+	}
+	return s.factors.SetCounter(factor.ID, factor.Counter, counter+1)
+}
+
+// matchHOTP returns the counter code was generated for, searching window
+// values from start.
+func matchHOTP(code, secret string, params model.TOTPParams, start uint64, window int) (uint64, bool) {
+	if secret == "" || code == "" {
+		return 0, false
+	}
+	opts := hotpValidateOpts(params)
+	for counter := start; counter < start+uint64(window); counter++ {
+		valid, err := hotp.ValidateCustom(code, counter, secret, opts)
+		if err != nil {
+			return 0, false
+		}
+		if valid {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// matchHOTPPair returns the counter following the two consecutive codes,
+// searching window values from start.
+func matchHOTPPair(codes *dto.HOTPCodesDto, secret string, params model.TOTPParams, start uint64, window int) (uint64, bool) {
+	opts := hotpValidateOpts(params)
+	for window > 0 {
+		counter, ok := matchHOTP(codes.FirstCode, secret, params, start, window)
+		if !ok {
+			return 0, false
+		}
+		valid, err := hotp.ValidateCustom(codes.SecondCode, counter+1, secret, opts)
+		if err != nil {
+			return 0, false
+		}
+		if valid {
+			return counter + 2, true
+		}
+		window -= int(counter + 1 - start)
+		start = counter + 1
+	}
+	return 0, false
+}
+
+func hotpValidateOpts(params model.TOTPParams) hotp.ValidateOpts {
+	return hotp.ValidateOpts{
+		Digits:    otp.Digits(params.Digits),
+		Algorithm: otpAlgorithm(params.Algorithm),
+	}
+}
@@ -0,0 +1,187 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/pquerna/otp/hotp"
+)
+
+const hotpSecret = "JBSWY3DPEHPK3PXP"
+
+func hotpCode(t *testing.T, counter uint64) string {
+	t.Helper()
+	code, err := hotp.GenerateCode(hotpSecret, counter)
+	if err != nil {
+		t.Fatalf("unexpected error generating code: %v", err)
+	}
+	return code
+}
+
+func TestEnrollHOTP2FA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SaveFactorQuery).
+		ExpectExec().
+		WithArgs(int64(1), "hotp", "Key fob", sqlmock.AnyArg(), "SHA1", 6, 0, 5, true, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectPrepare(mysql.Enable2FAQuery).
+		ExpectExec().
+		WithArgs("hotp", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectFirstRecoveryCodes(mock)
+
+	tokens, err := svc.EnrollHOTP2FA("1", &dto.HOTPEnrollDto{
+		Secret:       "jbsw y3dp ehpk 3pxp",
+		HOTPCodesDto: dto.HOTPCodesDto{FirstCode: hotpCode(t, 3), SecondCode: hotpCode(t, 4)},
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens.RecoveryCodes) != 10 {
+		t.Errorf("expected 10 recovery codes, got %d", len(tokens.RecoveryCodes))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnrollHOTP2FARejectsBadInput(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	_, err = svc.EnrollHOTP2FA("1", &dto.HOTPEnrollDto{Secret: "not base32!"}, "127.0.0.1")
+	if !errors.Is(err, service.ErrInvalidHOTPSecret) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidHOTPSecret, err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+
+	_, err = svc.EnrollHOTP2FA("1", &dto.HOTPEnrollDto{
+		Secret:       hotpSecret,
+		HOTPCodesDto: dto.HOTPCodesDto{FirstCode: hotpCode(t, 3), SecondCode: hotpCode(t, 5)},
+	}, "127.0.0.1")
+	if !errors.Is(err, service.ErrHOTPNotSynchronized) {
+		t.Errorf("expected error: %v, got %v", service.ErrHOTPNotSynchronized, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateHOTPLookAhead(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "hotp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "hotp", "Key fob", hotpSecret, "SHA1", 6, 0, 10, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorCounterQuery).
+		ExpectExec().
+		WithArgs(14, sqlmock.AnyArg(), 1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	tokens, err := svc.Validate2FA("1", &dto.OTPDto{Code: hotpCode(t, 13)}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens.AccessToken) == 0 {
+		t.Error("access token should not be empty")
+	}
+
+	// Codes before the stored counter were already used, codes past the
+	// look-ahead window need a resync.
+	for _, counter := range []uint64{9, 20} {
+		mock.ExpectPrepare(mysql.GetUserByIDQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(userByIDRows().
+				AddRow("santiago@google.com", "hash123", true, "hotp", nil, false, time.Now(), nil))
+		mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(factorRows().
+				AddRow(1, 1, "hotp", "Key fob", hotpSecret, "SHA1", 6, 0, 10, 0, true, time.Now(), nil))
+
+		_, err = svc.Validate2FA("1", &dto.OTPDto{Code: hotpCode(t, counter)}, "127.0.0.1")
+		if !errors.Is(err, service.ErrInvalidPasscode) {
+			t.Errorf("expected error: %v for counter %d, got %v", service.ErrInvalidPasscode, counter, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResyncHOTP(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "hotp", "Key fob", hotpSecret, "SHA1", 6, 0, 10, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorCounterQuery).
+		ExpectExec().
+		WithArgs(502, sqlmock.AnyArg(), 1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	_, err = svc.ResyncHOTP("1", &dto.HOTPCodesDto{FirstCode: hotpCode(t, 500), SecondCode: hotpCode(t, 501)}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
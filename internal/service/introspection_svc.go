@@ -0,0 +1,138 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const refreshTokenHint = "refresh_token"
+
+// Introspect implements RFC 7662 for confidential clients such as resource
+// servers. Unknown, expired or revoked tokens, and tokens issued to another
+// client, are reported as inactive. First-party access tokens, issued to no
+// client, can be introspected by any of them.
+func (s *OIDCService) Introspect(data *dto.IntrospectDto) (*dto.IntrospectionDto, error) {
+	client, err := s.clients.Authenticate(data.ClientID, data.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic() {
+		return nil, ErrInvalidClient
+	}
+	if data.TokenTypeHint != refreshTokenHint {
+		result, err := s.introspectAccessToken(client, data.Token)
+		if err != nil || result.Active {
+			return result, err
+		}
+	}
+	return s.introspectRefreshToken(client, data.Token)
+}
+
+func (s *OIDCService) introspectAccessToken(client *model.OAuthClient, token string) (*dto.IntrospectionDto, error) {
+	claims, ok := s.parseAccessToken(token)
+	if !ok || (claims.ClientID != "" && claims.ClientID != client.ID) {
+		return &dto.IntrospectionDto{}, nil
+	}
+	revoked, err := s.auth.revocations.IsRevoked(claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &dto.IntrospectionDto{}, nil
+	}
+	result := &dto.IntrospectionDto{
+		Active:    true,
+		Scope:     claims.OAuthScope,
+		ClientID:  claims.ClientID,
+		TokenType: "Bearer",
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		JTI:       claims.ID,
+		SessionID: claims.SessionID,
+		AMR:       claims.AMR,
+		ACR:       claims.ACR,
+	}
+	if claims.ExpiresAt != nil {
+		result.Expiration = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.AuthTime != nil {
+		result.AuthTime = claims.AuthTime.Unix()
+	}
+	return result, nil
+}
+
+func (s *OIDCService) introspectRefreshToken(client *model.OAuthClient, token string) (*dto.IntrospectionDto, error) {
+	current, err := s.auth.tokenRepo.GetByHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return &dto.IntrospectionDto{}, nil
+		}
+		return nil, err
+	}
+	if current.ClientID != client.ID || current.UsedAt != nil || current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return &dto.IntrospectionDto{}, nil
+	}
+	result := &dto.IntrospectionDto{
+		Active:     true,
+		Scope:      current.Scope,
+		ClientID:   current.ClientID,
+		TokenType:  refreshTokenHint,
+		Subject:    strconv.FormatInt(current.UserID, 10),
+		Expiration: current.ExpiresAt.Unix(),
+		SessionID:  current.FamilyID,
+		AMR:        current.AMR,
+		ACR:        acrFor(current.AMR),
+	}
+	if !current.AuthTime.IsZero() {
+		result.AuthTime = current.AuthTime.Unix()
+	}
+	return result, nil
+}
+
+// Revoke implements RFC 7009. Revoking a refresh token revokes every token
+// rotated from the same sign-in. Unknown tokens and tokens issued to another
+// client are not an error, they are left untouched.
+func (s *OIDCService) Revoke(data *dto.RevokeTokenDto) error {
+	client, err := s.clients.Authenticate(data.ClientID, data.ClientSecret)
+	if err != nil {
+		return err
+	}
+	if data.TokenTypeHint != refreshTokenHint {
+		if claims, ok := s.parseAccessToken(data.Token); ok {
+			if claims.ClientID != client.ID {
+				return nil
+			}
+			return s.auth.revocations.Revoke(claims)
+		}
+	}
+	current, err := s.auth.tokenRepo.GetByHash(hashToken(data.Token))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return nil
+		}
+		return err
+	}
+	if current.ClientID != client.ID {
+		return nil
+	}
+	return s.auth.tokenRepo.RevokeFamily(current.FamilyID)
+}
+
+// parseAccessToken only accepts valid tokens with the access scope, MFA
+// pending tokens are never reported as active.
+func (s *OIDCService) parseAccessToken(token string) (*model.Claims, bool) {
+	var claims model.Claims
+	parsed, err := jwt.ParseWithClaims(token, &claims, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.Methods()))
+	if err != nil || !parsed.Valid || claims.Scope != model.ScopeAccess {
+		return nil, false
+	}
+	return &claims, true
+}
@@ -0,0 +1,266 @@
+package service_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// clientAccessToken signs an access token issued to clientID with scope.
+func clientAccessToken(t *testing.T, clientID, scope string) string {
+	t.Helper()
+	now := time.Now()
+	token, err := testKeys.Sign(model.Claims{
+		Scope:      model.ScopeAccess,
+		ClientID:   clientID,
+		OAuthScope: scope,
+		SessionID:  "family1",
+		AMR:        []string{model.AMRPassword, model.AMROTP},
+		AuthTime:   jwt.NewNumericDate(now),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti-" + clientID,
+			Issuer:    "otp-api",
+			Subject:   "1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return token
+}
+
+func TestIntrospectAccessToken(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	token := clientAccessToken(t, testClientID, "openid email")
+	expectClient(mock, hashRefreshToken("s3cret"))
+	result, err := svc.Introspect(&dto.IntrospectDto{Token: token, ClientID: testClientID, ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Active || result.Subject != "1" || result.SessionID != "family1" {
+		t.Errorf("unexpected introspection %+v", result)
+	}
+	if result.Scope != "openid email" || result.ClientID != testClientID {
+		t.Errorf("expected the granted scope and client_id, got %q %q", result.Scope, result.ClientID)
+	}
+	if len(result.AMR) != 2 || result.Expiration <= time.Now().Unix() {
+		t.Errorf("expected amr and a future exp, got %+v", result)
+	}
+
+	expectClient(mock, hashRefreshToken("s3cret"))
+	if err := svc.Revoke(&dto.RevokeTokenDto{Token: token, ClientID: testClientID, ClientSecret: "s3cret"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectClient(mock, hashRefreshToken("s3cret"))
+	expectNoRefreshToken(mock, token)
+	result, err = svc.Introspect(&dto.IntrospectDto{Token: token, ClientID: testClientID, ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Active {
+		t.Error("a revoked token should not be active")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIntrospectAndRevokeOtherClientsTokens(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	other := clientAccessToken(t, "client-2", "openid")
+	expectClient(mock, hashRefreshToken("s3cret"))
+	expectNoRefreshToken(mock, other)
+	result, err := svc.Introspect(&dto.IntrospectDto{Token: other, ClientID: testClientID, ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Active {
+		t.Error("tokens of another client should not be active")
+	}
+
+	expectClient(mock, hashRefreshToken("s3cret"))
+	if err := svc.Revoke(&dto.RevokeTokenDto{Token: other, ClientID: testClientID, ClientSecret: "s3cret"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mock.ExpectPrepare(mysql.GetOAuthClientQuery).
+		ExpectQuery().
+		WithArgs("client-2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "secret_hash", "redirect_uris"}).
+			AddRow("client-2", "other", hashRefreshToken("s3cret"), testRedirectURI))
+	result, err = svc.Introspect(&dto.IntrospectDto{Token: other, ClientID: "client-2", ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Active {
+		t.Error("another client should not be able to revoke the token")
+	}
+
+	hash := hashRefreshToken("refresh123")
+	expectClient(mock, hashRefreshToken("s3cret"))
+	mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+		ExpectQuery().
+		WithArgs(hash).
+		WillReturnRows(refreshTokenRows().
+			AddRow(7, 1, "family1", hash, "pwd", time.Now(), time.Now().Add(time.Hour), nil, nil, "client-2", "openid"))
+	err = svc.Revoke(&dto.RevokeTokenDto{
+		Token:         "refresh123",
+		TokenTypeHint: "refresh_token",
+		ClientID:      testClientID,
+		ClientSecret:  "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIntrospectFirstPartyToken(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	token, err := newAuthService(db).GenerateAccessToken("1", "family1", []string{model.AMRPassword, model.AMROTP, model.AMRMFA}, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectClient(mock, hashRefreshToken("s3cret"))
+	result, err := svc.Introspect(&dto.IntrospectDto{Token: token, ClientID: testClientID, ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Active || result.Subject != "1" || result.ClientID != "" || result.Expiration <= time.Now().Unix() {
+		t.Errorf("expected a first-party token to be active for any client, got %+v", result)
+	}
+	if !model.HasAMR(result.AMR, model.AMROTP) || result.ACR != model.ACRMFA || result.AuthTime == 0 {
+		t.Errorf("expected the authentication details, got amr %v acr %q auth_time %d", result.AMR, result.ACR, result.AuthTime)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIntrospectMFAPendingToken(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	token, err := newAuthService(db).GenerateMFAPendingToken("1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectClient(mock, hashRefreshToken("s3cret"))
+	expectNoRefreshToken(mock, token)
+	result, err := svc.Introspect(&dto.IntrospectDto{Token: token, ClientID: testClientID, ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Active {
+		t.Error("mfa pending tokens should not be active")
+	}
+}
+
+func TestIntrospectRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	hash := hashRefreshToken("refresh123")
+	expectClient(mock, hashRefreshToken("s3cret"))
+	mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+		ExpectQuery().
+		WithArgs(hash).
+		WillReturnRows(refreshTokenRows().
+			AddRow(7, 1, "family1", hash, "pwd", time.Now(), time.Now().Add(time.Hour), nil, nil, testClientID, "openid"))
+
+	result, err := svc.Introspect(&dto.IntrospectDto{
+		Token:         "refresh123",
+		TokenTypeHint: "refresh_token",
+		ClientID:      testClientID,
+		ClientSecret:  "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Active || result.Subject != "1" || result.TokenType != "refresh_token" || result.ClientID != testClientID || result.Scope != "openid" {
+		t.Errorf("unexpected introspection %+v", result)
+	}
+
+	expectClient(mock, hashRefreshToken("s3cret"))
+	mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+		ExpectQuery().
+		WithArgs(hash).
+		WillReturnRows(refreshTokenRows().
+			AddRow(7, 1, "family1", hash, "pwd", time.Now(), time.Now().Add(time.Hour), nil, nil, testClientID, "openid"))
+	mock.ExpectPrepare(mysql.RevokeRefreshTokenFamilyQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "family1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	err = svc.Revoke(&dto.RevokeTokenDto{
+		Token:         "refresh123",
+		TokenTypeHint: "refresh_token",
+		ClientID:      testClientID,
+		ClientSecret:  "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIntrospectRequiresConfidentialClient(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	expectClient(mock, nil)
+	_, err = svc.Introspect(&dto.IntrospectDto{Token: "token", ClientID: testClientID})
+	if !errors.Is(err, service.ErrInvalidClient) {
+		t.Errorf("expected %v, got %v", service.ErrInvalidClient, err)
+	}
+}
+
+func expectNoRefreshToken(mock sqlmock.Sqlmock, token string) {
+	mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+		ExpectQuery().
+		WithArgs(hashRefreshToken(token)).
+		WillReturnError(sql.ErrNoRows)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+type AttemptRepository interface {
+	// Update loads the counter of key, or a zero one, lets update change it
+	// and stores the result in a single atomic step, so parallel attempts
+	// on the same key are applied one after the other.
+	Update(key string, update func(attempt *model.LoginAttempt)) error
+	Delete(key string) error
+}
+
+// LockoutError carries how long the caller has to wait before trying again.
+type LockoutError struct {
+	RetryAfter time.Duration
+	// Locked is set when the account itself is locked, as opposed to the
+	// caller being throttled.
+	Locked bool
+}
+
+func (e *LockoutError) Error() string {
+	return e.Unwrap().Error()
+}
+
+func (e *LockoutError) Unwrap() error {
+	if e.Locked {
+		return ErrAccountLocked
+	}
+	return ErrTooManyAttempts
+}
+
+// LockoutService counts failed attempts per account and per client IP.
+// Every failure doubles the wait before the next attempt and reaching the
+// threshold locks the key for LockoutDuration.
+type LockoutService struct {
+	repo AttemptRepository
+	cfg  config.Lockout
+}
+
+func NewLockoutService(repo AttemptRepository, cfg config.Lockout) *LockoutService {
+	return &LockoutService{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+// Reserve counts an attempt against the account and the client IP before
+// it is validated, so parallel attempts cannot all get past the limits
+// before the first failure is stored. The attempt stays counted as a
+// failure unless it is given back with Reset or Release.
+func (s *LockoutService) Reserve(account, ip string) error {
+	if err := s.reserve("account:"+account, s.cfg.AccountThreshold, true); err != nil {
+		return err
+	}
+	if err := s.reserve("ip:"+ip, s.cfg.IPThreshold, false); err != nil {
+		if rerr := s.release("account:" + account); rerr != nil {
+			return rerr
+		}
+		return err
+	}
+	return nil
+}
+
+// Reset clears the account counter after a successful attempt. The IP only
+// gets the attempt back, so one valid account cannot unlock guessing others.
+func (s *LockoutService) Reset(account, ip string) error {
+	if err := s.repo.Delete("account:" + account); err != nil {
+		return err
+	}
+	return s.release("ip:" + ip)
+}
+
+// Release gives back an attempt that failed for another reason than a wrong
+// credential.
+func (s *LockoutService) Release(account, ip string) error {
+	if err := s.release("account:" + account); err != nil {
+		return err
+	}
+	return s.release("ip:" + ip)
+}
+
+// reserve refuses the attempt while key is locked or backing off, and locks
+// it once threshold attempts have been counted.
+func (s *LockoutService) reserve(key string, threshold int, account bool) error {
+	var lockoutErr *LockoutError
+	err := s.repo.Update(key, func(attempt *model.LoginAttempt) {
+		now := time.Now()
+		if now.Before(attempt.LockedUntil) {
+			lockoutErr = &LockoutError{RetryAfter: attempt.LockedUntil.Sub(now), Locked: account}
+			return
+		}
+		if attempt.LastFailureAt.Before(now.Add(-s.cfg.ResetAfter)) {
+			attempt.Failures = 0
+		}
+		if attempt.Failures >= threshold {
+			attempt.Failures = 0
+			attempt.LockedUntil = now.Add(s.cfg.LockoutDuration)
+			lockoutErr = &LockoutError{RetryAfter: s.cfg.LockoutDuration, Locked: account}
+			return
+		}
+		if attempt.Failures > 0 {
+			if wait := attempt.LastFailureAt.Add(s.backoff(attempt.Failures)).Sub(now); wait > 0 {
+				lockoutErr = &LockoutError{RetryAfter: wait}
+				return
+			}
+		}
+		attempt.Failures++
+		attempt.LastFailureAt = now
+	})
+	if err != nil {
+		return err
+	}
+	if lockoutErr != nil {
+		return lockoutErr
+	}
+	return nil
+}
+
+func (s *LockoutService) release(key string) error {
+	return s.repo.Update(key, func(attempt *model.LoginAttempt) {
+		if attempt.Failures > 0 {
+			attempt.Failures--
+		}
+	})
+}
+
+func (s *LockoutService) backoff(failures int) time.Duration {
+	delay := s.cfg.BaseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= s.cfg.MaxDelay {
+			return s.cfg.MaxDelay
+		}
+	}
+	return delay
+}
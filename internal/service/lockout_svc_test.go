@@ -0,0 +1,167 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/memory"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+func TestLockoutBackoff(t *testing.T) {
+	cfg := config.DefaultLockout()
+	svc := service.NewLockoutService(memory.NewAttemptRepository(), cfg)
+
+	if err := svc.Reserve("user@google.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err := svc.Reserve("user@google.com", "10.0.0.1")
+	var lockoutErr *service.LockoutError
+	if !errors.As(err, &lockoutErr) {
+		t.Fatalf("expected a lockout error, got %v", err)
+	}
+	if !errors.Is(err, service.ErrTooManyAttempts) {
+		t.Errorf("expected error: %v, got %v", service.ErrTooManyAttempts, err)
+	}
+	if lockoutErr.RetryAfter <= 0 || lockoutErr.RetryAfter > cfg.BaseDelay {
+		t.Errorf("expected to wait the base delay, got %v", lockoutErr.RetryAfter)
+	}
+
+	// A refused attempt is not counted, Release gives back the one that ran.
+	if err := svc.Release("user@google.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := svc.Reserve("user@google.com", "10.0.0.1"); err != nil {
+		t.Fatalf("a released attempt should not back off, got %v", err)
+	}
+
+	if err := svc.Reset("user@google.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := svc.Reserve("user@google.com", "10.0.0.1"); err != nil {
+		t.Errorf("a successful attempt should clear the counters, got %v", err)
+	}
+}
+
+func TestLockoutThreshold(t *testing.T) {
+	cfg := config.DefaultLockout()
+	cfg.BaseDelay = 0
+	svc := service.NewLockoutService(memory.NewAttemptRepository(), cfg)
+
+	for i := 0; i < cfg.AccountThreshold; i++ {
+		if err := svc.Reserve("user@google.com", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i+1, err)
+		}
+	}
+
+	err := svc.Reserve("user@google.com", "10.0.0.2")
+	if !errors.Is(err, service.ErrAccountLocked) {
+		t.Fatalf("expected error: %v, got %v", service.ErrAccountLocked, err)
+	}
+	var lockoutErr *service.LockoutError
+	if errors.As(err, &lockoutErr) && lockoutErr.RetryAfter > cfg.LockoutDuration {
+		t.Errorf("retry after %v exceeds the lockout duration", lockoutErr.RetryAfter)
+	}
+	// The IP of the refused attempt got its reservation back.
+	for i := 0; i < cfg.IPThreshold; i++ {
+		if err := svc.Reserve(fmt.Sprintf("user%d@google.com", i), "10.0.0.2"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i+1, err)
+		}
+	}
+	if err := svc.Reserve("other@google.com", "10.0.0.2"); !errors.Is(err, service.ErrTooManyAttempts) {
+		t.Errorf("expected error: %v, got %v", service.ErrTooManyAttempts, err)
+	}
+}
+
+func TestLockoutConcurrentAttempts(t *testing.T) {
+	cfg := config.DefaultLockout()
+	cfg.BaseDelay = 0
+	svc := service.NewLockoutService(memory.NewAttemptRepository(), cfg)
+
+	var (
+		wg        sync.WaitGroup
+		validated atomic.Int32
+	)
+	for i := 0; i < cfg.AccountThreshold*4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := svc.Reserve("user@google.com", "10.0.0.1"); err != nil {
+				return
+			}
+			// Every guess is wrong, so the attempt stays counted.
+			validated.Add(1)
+		}()
+	}
+	wg.Wait()
+
+	if n := int(validated.Load()); n > cfg.AccountThreshold {
+		t.Errorf("expected at most %d guesses to be validated, got %d", cfg.AccountThreshold, n)
+	}
+	if err := svc.Reserve("user@google.com", "10.0.0.1"); !errors.Is(err, service.ErrAccountLocked) {
+		t.Errorf("expected error: %v, got %v", service.ErrAccountLocked, err)
+	}
+}
+
+func TestLockoutReservesInSQL(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	cfg := config.DefaultLockout()
+	cfg.AccountThreshold = 3
+	svc := service.NewLockoutService(mysql.NewAttemptRepository(db), cfg)
+
+	if !strings.HasSuffix(mysql.GetLoginAttemptQuery, "FOR UPDATE") {
+		t.Fatalf("the counter should be locked while it is updated: %s", mysql.GetLoginAttemptQuery)
+	}
+	expectAttempt := func(key string, failures int, lastFailureAt any) {
+		mock.ExpectBegin()
+		mock.ExpectExec(mysql.CreateLoginAttemptQuery).
+			WithArgs(key).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(mysql.GetLoginAttemptQuery).
+			WithArgs(key).
+			WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure_at", "locked_until"}).
+				AddRow(failures, lastFailureAt, nil))
+	}
+
+	expectAttempt("account:user@google.com", 0, nil)
+	mock.ExpectExec(mysql.UpdateLoginAttemptQuery).
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "account:user@google.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectAttempt("ip:10.0.0.1", 0, nil)
+	mock.ExpectExec(mysql.UpdateLoginAttemptQuery).
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "ip:10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := svc.Reserve("user@google.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Other requests already reserved the remaining attempts, so this one
+	// locks the account without reaching the validator.
+	expectAttempt("account:user@google.com", 3, time.Now().Add(-time.Minute))
+	mock.ExpectExec(mysql.UpdateLoginAttemptQuery).
+		WithArgs(0, sqlmock.AnyArg(), sqlmock.AnyArg(), "account:user@google.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := svc.Reserve("user@google.com", "10.0.0.1"); !errors.Is(err, service.ErrAccountLocked) {
+		t.Fatalf("expected error: %v, got %v", service.ErrAccountLocked, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	authorizationCodeTTL = time.Minute * 5
+	idTokenTTL           = time.Hour
+
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var supportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+type AuthorizationCodeRepository interface {
+	Save(c *model.AuthorizationCode) error
+	GetByHash(hash string) (*model.AuthorizationCode, error)
+	MarkUsed(id int64, familyID string) error
+}
+
+// OIDCService implements the OpenID Connect authorization code flow with
+// PKCE on top of AuthService, which still checks passwords and codes.
+type OIDCService struct {
+	auth    *AuthService
+	clients *ClientService
+	codes   AuthorizationCodeRepository
+	repo    UserRepository
+	keys    *signing.KeySet
+	cfg     config.OIDC
+}
+
+func NewOIDCService(auth *AuthService, clients *ClientService, codes AuthorizationCodeRepository, repo UserRepository, keys *signing.KeySet, cfg config.OIDC) *OIDCService {
+	return &OIDCService{
+		auth:    auth,
+		clients: clients,
+		codes:   codes,
+		repo:    repo,
+		keys:    keys,
+		cfg:     cfg,
+	}
+}
+
+// ValidateAuthorizeRequest returns ErrInvalidClient or ErrInvalidRedirectURI
+// when the error must not be sent back to the redirect URI.
+func (s *OIDCService) ValidateAuthorizeRequest(data *dto.AuthorizeRequestDto) error {
+	client, err := s.clients.GetClient(data.ClientID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.clients.RedirectURI(client, data.RedirectURI); err != nil {
+		return err
+	}
+	if data.ResponseType != "code" {
+		return ErrUnsupportedResponseType
+	}
+	if !hasOAuthScope(data.Scope, ScopeOpenID) {
+		return ErrInvalidScope
+	}
+	if data.CodeChallenge == "" {
+		return fmt.Errorf("%w: code_challenge is required", ErrInvalidOAuthRequest)
+	}
+	if data.CodeChallengeMethod != "S256" {
+		return fmt.Errorf("%w: code_challenge_method must be S256", ErrInvalidOAuthRequest)
+	}
+	return nil
+}
+
+// Authorize signs the user in and returns a single use authorization code.
+func (s *OIDCService) Authorize(data *dto.AuthorizeDto, clientIP string) (string, error) {
+	if err := s.ValidateAuthorizeRequest(&data.AuthorizeRequestDto); err != nil {
+		return "", err
+	}
+	user, amr, err := s.auth.Authenticate(&dto.SignInDto{Email: data.Email, Password: data.Password}, data.Code, data.RecoveryCode, clientIP)
+	if err != nil {
+		return "", err
+	}
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = s.codes.Save(&model.AuthorizationCode{
+		CodeHash:      hashToken(code),
+		ClientID:      data.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   data.RedirectURI,
+		Scope:         grantedScope(data.Scope),
+		Nonce:         data.Nonce,
+		CodeChallenge: data.CodeChallenge,
+		AMR:           amr,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Exchange implements the token endpoint for the authorization_code and
+// refresh_token grants.
+func (s *OIDCService) Exchange(data *dto.TokenRequestDto) (*dto.OIDCTokenDto, error) {
+	client, err := s.clients.Authenticate(data.ClientID, data.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	switch data.GrantType {
+	case "authorization_code":
+		return s.exchangeCode(client, data)
+	case "refresh_token":
+		tokens, err := s.auth.rotateRefreshToken(data.RefreshToken, client.ID)
+		if err != nil {
+			if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+			}
+			return nil, err
+		}
+		return &dto.OIDCTokenDto{
+			AccessToken:  tokens.AccessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    tokens.ExpiresIn,
+			RefreshToken: tokens.RefreshToken,
+		}, nil
+	default:
+		return nil, ErrUnsupportedGrantType
+	}
+}
+
+// exchangeCode redeems an authorization code. Presenting a code twice
+// revokes the refresh tokens issued the first time.
+func (s *OIDCService) exchangeCode(client *model.OAuthClient, data *dto.TokenRequestDto) (*dto.OIDCTokenDto, error) {
+	code, err := s.codes.GetByHash(hashToken(data.Code))
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientID != client.ID {
+		return nil, ErrInvalidGrant
+	}
+	if code.UsedAt != nil {
+		if code.FamilyID != "" {
+			if err := s.auth.tokenRepo.RevokeFamily(code.FamilyID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrInvalidGrant
+	}
+	if time.Now().After(code.ExpiresAt) || code.RedirectURI != data.RedirectURI {
+		return nil, ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(code.CodeChallenge, data.CodeVerifier) {
+		return nil, fmt.Errorf("%w: code_verifier does not match", ErrInvalidGrant)
+	}
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.codes.MarkUsed(code.ID, familyID); err != nil {
+		return nil, err
+	}
+	userID := strconv.FormatInt(code.UserID, 10)
+	tokens, err := s.auth.issueClientTokens(userID, familyID, client.ID, code.Scope, code.AMR, code.AuthTime)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := s.generateIDToken(client, code)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.OIDCTokenDto{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      idToken,
+		Scope:        code.Scope,
+	}, nil
+}
+
+func (s *OIDCService) generateIDToken(client *model.OAuthClient, code *model.AuthorizationCode) (string, error) {
+	userID := strconv.FormatInt(code.UserID, 10)
+	user, err := s.repo.GetProfile(userID)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := model.IDTokenClaims{
+		Nonce:    code.Nonce,
+		AuthTime: jwt.NewNumericDate(code.AuthTime),
+		AMR:      code.AMR,
+		ACR:      acrFor(code.AMR),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{client.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(idTokenTTL)),
+		},
+	}
+	if hasOAuthScope(code.Scope, ScopeEmail) {
+		claims.Email = user.Email
+	}
+	if hasOAuthScope(code.Scope, ScopeProfile) {
+		claims.GivenName = user.FirstName
+		claims.FamilyName = user.LastName
+		claims.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	return s.keys.Sign(claims)
+}
+
+// UserInfo returns the claims about the user the client was granted scope
+// for.
+func (s *OIDCService) UserInfo(userID, scope string) (*dto.UserInfoDto, error) {
+	user, err := s.repo.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	info := &dto.UserInfoDto{Subject: userID}
+	if hasOAuthScope(scope, ScopeEmail) {
+		info.Email = user.Email
+	}
+	if hasOAuthScope(scope, ScopeProfile) {
+		info.GivenName = user.FirstName
+		info.FamilyName = user.LastName
+		info.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	return info, nil
+}
+
+func (s *OIDCService) Discovery() dto.OpenIDConfigurationDto {
+	issuer := s.cfg.Issuer
+	return dto.OpenIDConfigurationDto{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  s.keys.Methods(),
+		ScopesSupported:                   supportedScopes,
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "amr", "acr", "nonce", "email", "name", "given_name", "family_name"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}
+}
+
+// verifyCodeChallenge checks the PKCE verifier against the S256 challenge.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// grantedScope drops the scopes this provider does not know about.
+func grantedScope(scope string) string {
+	granted := make([]string, 0, len(supportedScopes))
+	for _, s := range supportedScopes {
+		if hasOAuthScope(scope, s) {
+			granted = append(granted, s)
+		}
+	}
+	return strings.Join(granted, " ")
+}
+
+func hasOAuthScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
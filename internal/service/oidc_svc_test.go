@@ -0,0 +1,461 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testClientID     = "client-1"
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func newOIDCService(db *sql.DB) *service.OIDCService {
+	return service.NewOIDCService(
+		newAuthService(db),
+		service.NewClientService(mysql.NewOAuthClientRepository(db)),
+		mysql.NewAuthorizationCodeRepository(db),
+		mysql.NewUserRepository(db),
+		testKeys,
+		config.DefaultOIDC(),
+	)
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func authorizeRequest() dto.AuthorizeRequestDto {
+	return dto.AuthorizeRequestDto{
+		ResponseType:        "code",
+		ClientID:            testClientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               "openid email unknown",
+		State:               "xyz",
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       codeChallenge(testCodeVerifier),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+func expectClient(mock sqlmock.Sqlmock, secretHash interface{}) {
+	mock.ExpectPrepare(mysql.GetOAuthClientQuery).
+		ExpectQuery().
+		WithArgs(testClientID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "secret_hash", "redirect_uris"}).
+			AddRow(testClientID, "app", secretHash, testRedirectURI+" http://localhost:3000/callback"))
+}
+
+func authorizationCodeRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "code_hash", "client_id", "user_id", "redirect_uri", "scope", "nonce",
+		"code_challenge", "amr", "family_id", "auth_time", "expires_at", "used_at"})
+}
+
+func TestValidateAuthorizeRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*dto.AuthorizeRequestDto)
+		err    error
+	}{
+		{"valid", func(*dto.AuthorizeRequestDto) {}, nil},
+		{"unregistered redirect uri", func(r *dto.AuthorizeRequestDto) { r.RedirectURI = testRedirectURI + "/other" }, service.ErrInvalidRedirectURI},
+		{"implicit flow", func(r *dto.AuthorizeRequestDto) { r.ResponseType = "token" }, service.ErrUnsupportedResponseType},
+		{"missing openid scope", func(r *dto.AuthorizeRequestDto) { r.Scope = "email" }, service.ErrInvalidScope},
+		{"missing pkce", func(r *dto.AuthorizeRequestDto) { r.CodeChallenge = "" }, service.ErrInvalidOAuthRequest},
+		{"plain pkce", func(r *dto.AuthorizeRequestDto) { r.CodeChallengeMethod = "plain" }, service.ErrInvalidOAuthRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("error opening stub db connection: %v", err)
+			}
+			defer db.Close()
+			svc := newOIDCService(db)
+
+			expectClient(mock, nil)
+			req := authorizeRequest()
+			tt.modify(&req)
+			err = svc.ValidateAuthorizeRequest(&req)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestAuthorizeAndExchange(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	expectClient(mock, nil)
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("santiago@google.com").
+		WillReturnRows(userByEmailRows().
+			AddRow(1, "santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", false, "totp", time.Now(), nil))
+	codeHash := &capturedArg{}
+	mock.ExpectPrepare(mysql.SaveAuthorizationCodeQuery).
+		ExpectExec().
+		WithArgs(codeHash, testClientID, 1, testRedirectURI, "openid email", "n-0S6_WzA2Mj",
+			codeChallenge(testCodeVerifier), "pwd", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	req := authorizeRequest()
+	code, err := svc.Authorize(&dto.AuthorizeDto{
+		AuthorizeRequestDto: req,
+		Email:               "santiago@google.com",
+		Password:            "santiago123",
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if hashRefreshToken(code) != codeHash.value {
+		t.Fatal("the authorization code should be stored hashed")
+	}
+
+	authTime := time.Now().Add(-time.Second)
+	expectClient(mock, nil)
+	mock.ExpectPrepare(mysql.GetAuthorizationCodeByHashQuery).
+		ExpectQuery().
+		WithArgs(codeHash.value).
+		WillReturnRows(authorizationCodeRows().
+			AddRow(7, codeHash.value, testClientID, 1, testRedirectURI, "openid email", "n-0S6_WzA2Mj",
+				codeChallenge(testCodeVerifier), "pwd", nil, authTime, time.Now().Add(time.Minute), nil))
+	familyID := &capturedArg{}
+	mock.ExpectPrepare(mysql.MarkAuthorizationCodeUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), familyID, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd", sqlmock.AnyArg(), sqlmock.AnyArg(), testClientID, "openid email").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectPrepare(mysql.GetUserProfileQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "email"}).
+			AddRow(1, "Santiago", "Bedoya", "santiago@google.com"))
+
+	tokens, err := svc.Exchange(&dto.TokenRequestDto{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testCodeVerifier,
+		ClientID:     testClientID,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.TokenType != "Bearer" {
+		t.Errorf("unexpected tokens %+v", tokens)
+	}
+
+	var claims model.IDTokenClaims
+	_, err = jwt.ParseWithClaims(tokens.IDToken, &claims, testKeys.Keyfunc,
+		jwt.WithValidMethods(testKeys.Methods()),
+		jwt.WithIssuer(config.DefaultOIDC().Issuer),
+		jwt.WithAudience(testClientID))
+	if err != nil {
+		t.Fatalf("unexpected error parsing the id token: %v", err)
+	}
+	if claims.Subject != "1" || claims.Nonce != "n-0S6_WzA2Mj" || claims.Email != "santiago@google.com" {
+		t.Errorf("unexpected id token claims %+v", claims)
+	}
+	if claims.Name != "" {
+		t.Error("profile claims should not be included without the profile scope")
+	}
+	if len(claims.AMR) != 1 || claims.AMR[0] != model.AMRPassword {
+		t.Errorf("expected amr [pwd], got %v", claims.AMR)
+	}
+	if claims.AuthTime == nil || claims.AuthTime.Unix() != authTime.Unix() {
+		t.Errorf("expected auth_time %d, got %v", authTime.Unix(), claims.AuthTime)
+	}
+
+	var access model.Claims
+	if _, err := jwt.ParseWithClaims(tokens.AccessToken, &access, testKeys.Keyfunc, jwt.WithValidMethods(testKeys.Methods())); err != nil {
+		t.Fatalf("unexpected error parsing the access token: %v", err)
+	}
+	if access.ClientID != testClientID || access.OAuthScope != "openid email" {
+		t.Errorf("expected the access token to carry the client and granted scope, got %q %q", access.ClientID, access.OAuthScope)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuthorizeSecondFactors(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+	const password = "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK"
+	data := &dto.AuthorizeDto{
+		AuthorizeRequestDto: authorizeRequest(),
+		Email:               "santiago@google.com",
+		Password:            "santiago123",
+	}
+
+	expectClient(mock, nil)
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("santiago@google.com").
+		WillReturnRows(userByEmailRows().
+			AddRow(1, "santiago@google.com", password, true, "webauthn", time.Now(), nil))
+	if _, err := svc.Authorize(data, "127.0.0.1"); !errors.Is(err, service.ErrSecurityKeyUnsupported) {
+		t.Errorf("expected %v, got %v", service.ErrSecurityKeyUnsupported, err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("abcdefghij"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectClient(mock, nil)
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("santiago@google.com").
+		WillReturnRows(userByEmailRows().
+			AddRow(1, "santiago@google.com", password, true, "webauthn", time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUnusedRecoveryCodesQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "code_hash"}).
+			AddRow(3, 1, string(hash)))
+	mock.ExpectPrepare(mysql.MarkRecoveryCodeUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveAuthorizationCodeQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), testClientID, 1, testRedirectURI, "openid email", "n-0S6_WzA2Mj",
+			codeChallenge(testCodeVerifier), "pwd recovery mfa", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	data.RecoveryCode = "abcde-fghij"
+	if _, err := svc.Authorize(data, "127.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExchangeRefreshTokenChecksClient(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+	hash := hashRefreshToken("refresh")
+	req := &dto.TokenRequestDto{GrantType: "refresh_token", RefreshToken: "refresh", ClientID: testClientID}
+
+	for _, clientID := range []interface{}{"client-2", nil} {
+		expectClient(mock, nil)
+		mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+			ExpectQuery().
+			WithArgs(hash).
+			WillReturnRows(refreshTokenRows().
+				AddRow(7, 1, "family1", hash, "pwd", time.Now(), time.Now().Add(time.Hour), nil, nil, clientID, "openid"))
+		if _, err := svc.Exchange(req); !errors.Is(err, service.ErrInvalidGrant) {
+			t.Errorf("client %v: expected %v, got %v", clientID, service.ErrInvalidGrant, err)
+		}
+	}
+
+	expectClient(mock, nil)
+	mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+		ExpectQuery().
+		WithArgs(hash).
+		WillReturnRows(refreshTokenRows().
+			AddRow(7, 1, "family1", hash, "pwd", time.Now(), time.Now().Add(time.Hour), nil, nil, testClientID, "openid"))
+	mock.ExpectPrepare(mysql.MarkRefreshTokenUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, "family1", sqlmock.AnyArg(), "pwd", sqlmock.AnyArg(), sqlmock.AnyArg(), testClientID, "openid").
+		WillReturnResult(sqlmock.NewResult(8, 1))
+	if _, err := svc.Exchange(req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUserInfoFiltersByScope(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectPrepare(mysql.GetUserProfileQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "email"}).
+				AddRow(1, "Santiago", "Bedoya", "santiago@google.com"))
+	}
+	info, err := svc.UserInfo("1", "openid")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Subject != "1" || info.Email != "" || info.Name != "" {
+		t.Errorf("expected only the subject without the email and profile scopes, got %+v", info)
+	}
+	info, err = svc.UserInfo("1", "openid profile")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Name != "Santiago Bedoya" || info.Email != "" {
+		t.Errorf("expected only the profile claims, got %+v", info)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	expectClient(mock, nil)
+	mock.ExpectPrepare(mysql.GetAuthorizationCodeByHashQuery).
+		ExpectQuery().
+		WithArgs(hashRefreshToken("code")).
+		WillReturnRows(authorizationCodeRows().
+			AddRow(7, hashRefreshToken("code"), testClientID, 1, testRedirectURI, "openid", "",
+				codeChallenge(testCodeVerifier), "pwd", nil, time.Now(), time.Now().Add(time.Minute), nil))
+
+	_, err = svc.Exchange(&dto.TokenRequestDto{
+		GrantType:    "authorization_code",
+		Code:         "code",
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: strings.Repeat("a", 43),
+		ClientID:     testClientID,
+	})
+	if !errors.Is(err, service.ErrInvalidGrant) {
+		t.Errorf("expected %v, got %v", service.ErrInvalidGrant, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExchangeReplayedCodeRevokesTokens(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	expectClient(mock, nil)
+	mock.ExpectPrepare(mysql.GetAuthorizationCodeByHashQuery).
+		ExpectQuery().
+		WithArgs(hashRefreshToken("code")).
+		WillReturnRows(authorizationCodeRows().
+			AddRow(7, hashRefreshToken("code"), testClientID, 1, testRedirectURI, "openid", "",
+				codeChallenge(testCodeVerifier), "pwd", "family-1", time.Now(), time.Now().Add(time.Minute), time.Now()))
+	mock.ExpectPrepare(mysql.RevokeRefreshTokenFamilyQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "family-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err = svc.Exchange(&dto.TokenRequestDto{
+		GrantType:    "authorization_code",
+		Code:         "code",
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testCodeVerifier,
+		ClientID:     testClientID,
+	})
+	if !errors.Is(err, service.ErrInvalidGrant) {
+		t.Errorf("expected %v, got %v", service.ErrInvalidGrant, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExchangeAuthenticatesConfidentialClients(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newOIDCService(db)
+
+	expectClient(mock, hashRefreshToken("s3cret"))
+	_, err = svc.Exchange(&dto.TokenRequestDto{
+		GrantType:    "authorization_code",
+		ClientID:     testClientID,
+		ClientSecret: "wrong",
+	})
+	if !errors.Is(err, service.ErrInvalidClient) {
+		t.Errorf("expected %v, got %v", service.ErrInvalidClient, err)
+	}
+
+	expectClient(mock, hashRefreshToken("s3cret"))
+	_, err = svc.Exchange(&dto.TokenRequestDto{
+		GrantType:    "password",
+		ClientID:     testClientID,
+		ClientSecret: "s3cret",
+	})
+	if !errors.Is(err, service.ErrUnsupportedGrantType) {
+		t.Errorf("expected %v, got %v", service.ErrUnsupportedGrantType, err)
+	}
+}
+
+func TestRegisterClientValidatesRedirectURIs(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	clients := service.NewClientService(mysql.NewOAuthClientRepository(db))
+
+	for _, uri := range []string{"http://app.example.com/cb", "https://app.example.com/cb#frag", "/cb"} {
+		if _, _, err := clients.Register("app", []string{uri}, false); !errors.Is(err, service.ErrInvalidRedirectURI) {
+			t.Errorf("%s: expected %v, got %v", uri, service.ErrInvalidRedirectURI, err)
+		}
+	}
+
+	secretHash := &capturedArg{}
+	mock.ExpectPrepare(mysql.SaveOAuthClientQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "app", secretHash, "https://app.example.com/cb http://127.0.0.1:8000/cb").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	client, secret, err := clients.Register("app", []string{"https://app.example.com/cb", "http://127.0.0.1:8000/cb"}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.ID == "" || secret == "" || hashRefreshToken(secret) != secretHash.value {
+		t.Error("expected a client id and a secret stored hashed")
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// validateTOTP accepts a code only when its time-step starts after the last
+// one accepted for the factor, so a code cannot be replayed inside its
+// validity window.
+func (s *AuthService) validateTOTP(factor *model.Factor, code string) error {
+	stepAt, ok := matchTOTPStep(code, factor.Secret, time.Now(), s.totpValidateOpts(factor.Params))
+	if !ok {
+		return ErrInvalidPasscode
+	}
+	if stepAt <= factor.LastOTPAt {
+		return ErrPasscodeReused
+	}
+	return s.factors.SetLastOTPAt(factor.ID, stepAt)
+}
+
+// matchTOTPStep returns the start, in unix seconds, of the time-step the
+// code was generated for.
+func matchTOTPStep(code, secret string, t time.Time, opts totp.ValidateOpts) (int64, bool) {
+	if secret == "" {
+		return 0, false
+	}
+	period := int64(opts.Period)
+	current := t.Unix() / period
+	skew := int64(opts.Skew)
+	opts.Skew = 0
+	for counter := current - skew; counter <= current+skew; counter++ {
+		stepAt := counter * period
+		valid, err := totp.ValidateCustom(code, secret, time.Unix(stepAt, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if valid {
+			return stepAt, true
+		}
+	}
+	return 0, false
+}
+
+// totpParams applies the options picked for a new authenticator app over
+// the configured defaults. Only parameters authenticator apps commonly
+// support are accepted.
+func (s *AuthService) totpParams(data *dto.TOTPOptionsDto) (model.TOTPParams, error) {
+	params := model.TOTPParams{
+		Algorithm: strings.ToUpper(data.Algorithm),
+		Digits:    data.Digits,
+		Period:    data.Period,
+	}
+	if params.Algorithm == "" {
+		params.Algorithm = s.totpCfg.Algorithm
+	}
+	if params.Digits == 0 {
+		params.Digits = s.totpCfg.Digits
+	}
+	if params.Period == 0 {
+		params.Period = s.totpCfg.Period
+	} else if params.Period != 30 && params.Period != 60 {
+		return model.TOTPParams{}, ErrInvalidTOTPParams
+	}
+	switch params.Algorithm {
+	case "SHA1", "SHA256", "SHA512":
+	default:
+		return model.TOTPParams{}, ErrInvalidTOTPParams
+	}
+	if params.Digits != 6 && params.Digits != 8 {
+		return model.TOTPParams{}, ErrInvalidTOTPParams
+	}
+	return params, nil
+}
+
+func (s *AuthService) totpValidateOpts(params model.TOTPParams) totp.ValidateOpts {
+	return totp.ValidateOpts{
+		Period:    params.Period,
+		Skew:      s.totpCfg.Skew,
+		Digits:    otp.Digits(params.Digits),
+		Algorithm: otpAlgorithm(params.Algorithm),
+	}
+}
+
+func otpAlgorithm(name string) otp.Algorithm {
+	switch name {
+	case "SHA256":
+		return otp.AlgorithmSHA256
+	case "SHA512":
+		return otp.AlgorithmSHA512
+	default:
+		return otp.AlgorithmSHA1
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+// BreachedPasswords tells whether a password appeared in a known breach.
+type BreachedPasswords interface {
+	Contains(password string) (bool, error)
+}
+
+// PasswordPolicyError lists every rule of the password policy a password
+// breaks. errors.Is matches ErrWeakPassword and each of the rules.
+type PasswordPolicyError struct {
+	Violations []error
+}
+
+func (e *PasswordPolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Error()
+	}
+	return ErrWeakPassword.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *PasswordPolicyError) Unwrap() []error {
+	return append([]error{ErrWeakPassword}, e.Violations...)
+}
+
+// validatePassword checks password against the policy for user, whose
+// email and names must not be part of it.
+func (s *AuthService) validatePassword(password string, user *model.User) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	var violations []error
+	if utf8.RuneCountInString(password) < s.policy.MinLength {
+		violations = append(violations, ErrPasswordTooShort)
+	}
+	if s.policy.MaxLength > 0 && len(password) > s.policy.MaxLength {
+		violations = append(violations, ErrPasswordTooLong)
+	}
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if s.policy.RequireLower && !lower {
+		violations = append(violations, ErrPasswordNoLower)
+	}
+	if s.policy.RequireUpper && !upper {
+		violations = append(violations, ErrPasswordNoUpper)
+	}
+	if s.policy.RequireDigit && !digit {
+		violations = append(violations, ErrPasswordNoDigit)
+	}
+	if s.policy.RequireSymbol && !symbol {
+		violations = append(violations, ErrPasswordNoSymbol)
+	}
+	if containsPersonalInfo(password, user) {
+		violations = append(violations, ErrPasswordPersonalInfo)
+	}
+	if s.breached != nil {
+		found, err := s.breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if found {
+			violations = append(violations, ErrPasswordBreached)
+		}
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// containsPersonalInfo reports whether password contains the email of user,
+// the part before its @ or one of their names. Parts shorter than three
+// characters are ignored, they would reject too many passwords.
+func containsPersonalInfo(password string, user *model.User) bool {
+	password = strings.ToLower(password)
+	email := strings.ToLower(user.Email)
+	local, _, _ := strings.Cut(email, "@")
+	for _, part := range []string{email, local, strings.ToLower(user.FirstName), strings.ToLower(user.LastName)} {
+		if utf8.RuneCountInString(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package service_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/breached"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+func TestSaveUserPasswordPolicy(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+
+	// SHA-1 of "123456" is 7C4A8D09CA3762AF61E59520943DC26494F8941B.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "7C4A8.txt"), []byte("D09CA3762AF61E59520943DC26494F8941B:37359195\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := breached.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := authServiceDeps(db)
+	deps.PasswordPolicy.RequireDigit = true
+	deps.Breached = list
+	svc := service.NewAuthService(deps)
+
+	tests := []struct {
+		password string
+		want     []error
+	}{
+		{"", []error{service.ErrPasswordRequired}},
+		{"123456", []error{service.ErrPasswordTooShort, service.ErrPasswordBreached}},
+		{"correct horse battery", []error{service.ErrPasswordNoDigit}},
+		{"Santiago-2024", []error{service.ErrPasswordPersonalInfo}},
+		{strings.Repeat("ñ", 37) + "1", []error{service.ErrPasswordTooLong}},
+	}
+	for _, tt := range tests {
+		user, err := svc.SaveUser(&dto.SignUpDto{
+			FirstName: "Santiago",
+			LastName:  "Bedoya",
+			Email:     "santiago@google.com",
+			Password:  tt.password,
+		})
+		if user != nil {
+			t.Errorf("%q: expected nil user, got %v", tt.password, user)
+		}
+		for _, want := range tt.want {
+			if !errors.Is(err, want) {
+				t.Errorf("%q: expected error: %v, got %v", tt.password, want, err)
+			}
+		}
+		var policyErr *service.PasswordPolicyError
+		if errors.As(err, &policyErr) && len(policyErr.Violations) != len(tt.want) {
+			t.Errorf("%q: expected %d violations, got %v", tt.password, len(tt.want), policyErr.Violations)
+		}
+	}
+
+	mock.ExpectPrepare(mysql.SaveUserQuery).
+		ExpectExec().
+		WithArgs("Santiago", "Bedoya", "santiago@google.com", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err := svc.SaveUser(&dto.SignUpDto{
+		FirstName: "Santiago",
+		LastName:  "Bedoya",
+		Email:     "santiago@google.com",
+		Password:  "correct horse battery 9",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChangePasswordPolicy(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", true, "totp", nil, false, time.Now(), nil))
+
+	err = svc.ChangePassword("1", &dto.ChangePasswordDto{
+		NewPassword:       "short",
+		VerifyIdentityDto: dto.VerifyIdentityDto{Password: "santiago123", Code: "123456"},
+	}, "127.0.0.1")
+	if !errors.Is(err, service.ErrPasswordTooShort) {
+		t.Errorf("expected error: %v, got %v", service.ErrPasswordTooShort, err)
+	}
+	// The passcode is not checked, so no factor is loaded.
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+type PasswordResetRepository interface {
+	Save(token *model.PasswordResetToken) error
+	// GetLatest returns the last reset requested by the user, or nil.
+	GetLatest(userID string) (*model.PasswordResetToken, error)
+	GetByHash(hash string) (*model.PasswordResetToken, error)
+	MarkUsed(id int64) error
+	InvalidateAll(userID string) error
+}
+
+// PasswordHasher hashes new passwords and checks passwords against stored
+// hashes of any algorithm it supports.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) error
+	// NeedsRehash tells whether hash uses a weaker algorithm or cost than
+	// the hashes made by Hash.
+	NeedsRehash(hash string) bool
+}
+
+// ForgotPassword emails a reset link to the user. Unknown addresses and
+// repeated requests within ResendInterval are ignored without an error, so
+// the response does not tell whether an account exists.
+func (s *AuthService) ForgotPassword(data *dto.ForgotPasswordDto) error {
+	user, err := s.repo.GetByEmail(data.Email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	userID := fmt.Sprint(user.ID)
+	latest, err := s.resets.GetLatest(userID)
+	if err != nil {
+		return err
+	}
+	if latest != nil && latest.UsedAt == nil && time.Since(latest.CreatedAt) < s.resetCfg.ResendInterval {
+		return nil
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(s.resetCfg.URL, token)
+	if err != nil {
+		return err
+	}
+	if err := s.resets.InvalidateAll(userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	err = s.resets.Save(&model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.resetCfg.TTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(&model.MailMessage{
+		To:      user.Email,
+		Subject: fmt.Sprintf("Reset your %s password", s.totpCfg.Issuer),
+		Body: fmt.Sprintf("Open the link below to choose a new password:\n\n%s\n\nIt expires in %d minutes. If you did not ask for it, you can ignore this email.\n",
+			link, int(s.resetCfg.TTL.Minutes())),
+	})
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword.
+// Accounts with 2FA must also pass their second factor, users of email or
+// SMS codes get one sent when none is given, once the new password meets
+// the policy. Every session of the user is revoked afterwards.
+func (s *AuthService) ResetPassword(data *dto.ResetPasswordDto, clientIP string) error {
+	if data.Password == "" {
+		return ErrPasswordRequired
+	}
+	reset, err := s.resets.GetByHash(hashToken(data.Token))
+	if err != nil {
+		return err
+	}
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	userID := fmt.Sprint(reset.UserID)
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.validatePassword(data.Password, user); err != nil {
+		return err
+	}
+	if user.Valid2FA {
+		if data.Code == "" && data.RecoveryCode == "" {
+			if err := s.sendSecondFactorCode(userID, user); err != nil {
+				return err
+			}
+			return ErrMFARequired
+		}
+		_, err := s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+			if data.RecoveryCode != "" {
+				return nil, s.useRecoveryCode(userID, data.RecoveryCode)
+			}
+			return nil, s.verifySecondFactor(userID, user, data.Code)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.resets.MarkUsed(reset.ID); err != nil {
+		return err
+	}
+	hash, err := s.hasher.Hash(data.Password)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(userID, hash); err != nil {
+		return err
+	}
+	if err := s.SignOutAll(userID); err != nil {
+		return err
+	}
+	return s.devices.DeleteAll(userID)
+}
+
+// rehashPassword upgrades the stored hash of user after password matched
+// it, when the hasher has been configured with a stronger algorithm or
+// cost since it was made.
+func (s *AuthService) rehashPassword(user *model.User, password string) error {
+	if !s.hasher.NeedsRehash(user.Password) {
+		return nil
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(fmt.Sprint(user.ID), hash); err != nil {
+		return err
+	}
+	user.Password = hash
+	return nil
+}
+
+// tokenLink adds token to the page at base as the token query parameter.
+func tokenLink(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
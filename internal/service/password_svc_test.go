@@ -0,0 +1,252 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/passhash"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/pquerna/otp/totp"
+)
+
+func passwordResetRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "used_at", "created_at"})
+}
+
+func expectPasswordUpdate(mock sqlmock.Sqlmock) {
+	mock.ExpectPrepare(mysql.MarkPasswordResetUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.UpdatePasswordQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.RevokeUserRefreshTokensQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectPrepare(mysql.DeleteUserTrustedDevicesQuery).
+		ExpectExec().
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestForgotPassword(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("nobody@google.com").
+		WillReturnRows(userByEmailRows())
+	sent := len(testMailer.Messages())
+	if err := svc.ForgotPassword(&dto.ForgotPasswordDto{Email: "nobody@google.com"}); err != nil {
+		t.Fatalf("unexpected error for an unknown address: %v", err)
+	}
+	if len(testMailer.Messages()) != sent {
+		t.Fatal("no email should be sent to an unknown address")
+	}
+
+	var hash capturedArg
+	expectSignInWith2FA(mock)
+	mock.ExpectPrepare(mysql.GetLatestPasswordResetQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(passwordResetRows())
+	mock.ExpectPrepare(mysql.InvalidatePasswordResetsQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(mysql.SavePasswordResetQuery).
+		ExpectExec().
+		WithArgs(int64(1), &hash, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	if err := svc.ForgotPassword(&dto.ForgotPasswordDto{Email: "santiago@google.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := testMailer.Last()
+	if msg == nil || msg.To != "santiago@google.com" {
+		t.Fatalf("expected a reset link to be mailed to the user, got %+v", msg)
+	}
+	token := regexp.MustCompile(`token=([\w-]+)`).FindStringSubmatch(msg.Body)
+	if token == nil {
+		t.Fatalf("no reset link in %q", msg.Body)
+	}
+	sum := sha256.Sum256([]byte(token[1]))
+	if hex.EncodeToString(sum[:]) != hash.value {
+		t.Fatal("the mailed token does not match the stored hash")
+	}
+
+	sent = len(testMailer.Messages())
+	expectSignInWith2FA(mock)
+	mock.ExpectPrepare(mysql.GetLatestPasswordResetQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(passwordResetRows().
+			AddRow(3, 1, hash.value, time.Now().Add(time.Minute*30), nil, time.Now()))
+	if err := svc.ForgotPassword(&dto.ForgotPasswordDto{Email: "santiago@google.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(testMailer.Messages()) != sent {
+		t.Error("a second reset email should not be sent within the resend interval")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	if err := svc.ResetPassword(&dto.ResetPasswordDto{Token: "token"}, "127.0.0.1"); !errors.Is(err, service.ErrPasswordRequired) {
+		t.Errorf("expected error: %v, got %v", service.ErrPasswordRequired, err)
+	}
+
+	mock.ExpectPrepare(mysql.GetPasswordResetByHashQuery).
+		ExpectQuery().
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(passwordResetRows().
+			AddRow(3, 1, "hash", time.Now().Add(time.Minute), time.Now(), time.Now()))
+	err = svc.ResetPassword(&dto.ResetPasswordDto{Token: "token", Password: "new-password"}, "127.0.0.1")
+	if !errors.Is(err, service.ErrInvalidResetToken) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidResetToken, err)
+	}
+
+	mock.ExpectPrepare(mysql.GetPasswordResetByHashQuery).
+		ExpectQuery().
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(passwordResetRows().
+			AddRow(3, 1, "hash", time.Now().Add(time.Minute), nil, time.Now()))
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	expectPasswordUpdate(mock)
+
+	if err := svc.ResetPassword(&dto.ResetPasswordDto{Token: "token", Password: "new-password"}, "127.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResetPasswordWith2FA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectReset := func() {
+		mock.ExpectPrepare(mysql.GetPasswordResetByHashQuery).
+			ExpectQuery().
+			WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(passwordResetRows().
+				AddRow(3, 1, "hash", time.Now().Add(time.Minute), nil, time.Now()))
+		mock.ExpectPrepare(mysql.GetUserByIDQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(userByIDRows().
+				AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	}
+
+	expectReset()
+	err = svc.ResetPassword(&dto.ResetPasswordDto{Token: "token", Password: "new-password"}, "127.0.0.1")
+	if !errors.Is(err, service.ErrMFARequired) {
+		t.Errorf("expected error: %v, got %v", service.ErrMFARequired, err)
+	}
+
+	expectReset()
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPasswordUpdate(mock)
+
+	err = svc.ResetPassword(&dto.ResetPasswordDto{Token: "token", Password: "new-password", Code: code}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignInRehashesPassword(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	hasher, err := passhash.NewArgon2id(passhash.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := authServiceDeps(db)
+	deps.Hasher = hasher
+	svc := service.NewAuthService(deps)
+
+	var hash capturedArg
+	expectSignInWith2FA(mock)
+	mock.ExpectPrepare(mysql.UpdatePasswordQuery).
+		ExpectExec().
+		WithArgs(&hash, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	data := &dto.SignInDto{Email: "santiago@google.com", Password: "santiago123"}
+	if _, err := svc.SignIn(data, "127.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(hash.value, "$argon2id$") {
+		t.Fatalf("expected the bcrypt hash to be upgraded to argon2id, got %q", hash.value)
+	}
+
+	// The upgraded hash is kept as it is on the next sign in.
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("santiago@google.com").
+		WillReturnRows(userByEmailRows().
+			AddRow(1, "santiago@google.com", hash.value, true, "totp", time.Now(), nil))
+	if _, err := svc.SignIn(data, "127.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/png"
+
+	"github.com/boombuler/barcode/qr"
+	"github.com/pquerna/otp"
+)
+
+const qrQuietZone = 4
+
+func QRCodePNG(key *otp.Key, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	img, err := key.Image(size, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// QRCodeSVG draws one square per dark module, scaled to size by the viewBox
+// and surrounded by the quiet zone scanners expect.
+func QRCodeSVG(key *otp.Key, size int) ([]byte, error) {
+	code, err := qr.Encode(key.String(), qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+	modules := code.Bounds().Dx()
+	total := modules + 2*qrQuietZone
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="-%d -%d %d %d" shape-rendering="crispEdges">`,
+		size, size, qrQuietZone, qrQuietZone, total, total)
+	fmt.Fprintf(&buf, `<rect x="-%d" y="-%d" width="%d" height="%d" fill="#fff"/><path fill="#000" d="`,
+		qrQuietZone, qrQuietZone, total, total)
+	for y := 0; y < modules; y++ {
+		for x := 0; x < modules; x++ {
+			if code.At(x, y) == color.Black {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
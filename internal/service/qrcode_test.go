@@ -0,0 +1,38 @@
+package service_test
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestQRCode(t *testing.T) {
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pngBytes, err := service.QRCodePNG(key, 300)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(pngBytes))
+	if err != nil {
+		t.Fatalf("Unexpected error decoding png: %v", err)
+	}
+	if img.Bounds().Dx() != 300 || img.Bounds().Dy() != 300 {
+		t.Errorf("expected a 300x300 image, got %v", img.Bounds())
+	}
+
+	svg, err := service.QRCodeSVG(key, 300)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(svg), "<svg") || !strings.Contains(string(svg), `width="300"`) {
+		t.Errorf("unexpected svg output: %s", svg)
+	}
+}
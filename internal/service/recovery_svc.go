@@ -0,0 +1,71 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const recoveryCodeCount = 10
+
+type RecoveryCodeRepository interface {
+	ReplaceAll(userID string, hashes []string) error
+	GetUnused(userID string) ([]model.RecoveryCode, error)
+	MarkUsed(id int64) error
+}
+
+// GenerateRecoveryCodes replaces any previous set of recovery codes. The
+// plain codes are only returned here, they are stored hashed.
+func (s *AuthService) GenerateRecoveryCodes(userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(normalizeRecoveryCode(code)), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = string(hash)
+	}
+	if err := s.recoveryRepo.ReplaceAll(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *AuthService) useRecoveryCode(userID, code string) error {
+	codes, err := s.recoveryRepo.GetUnused(userID)
+	if err != nil {
+		return err
+	}
+	normalized := []byte(normalizeRecoveryCode(code))
+	for _, c := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(c.CodeHash), normalized) == nil {
+			return s.recoveryRepo.MarkUsed(c.ID)
+		}
+	}
+	return ErrInvalidRecoveryCode
+}
+
+// newRecoveryCode returns a code such as "abcde-fghij".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ToLower(code)
+}
@@ -0,0 +1,124 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// expectFirstRecoveryCodes expects the recovery codes handed out when the
+// first second factor is confirmed.
+func expectFirstRecoveryCodes(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec(mysql.DeleteRecoveryCodesQuery).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	prepare := mock.ExpectPrepare(mysql.SaveRecoveryCodeQuery)
+	for i := 0; i < 10; i++ {
+		prepare.ExpectExec().
+			WithArgs("1", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(mysql.DeleteRecoveryCodesQuery).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	prepare := mock.ExpectPrepare(mysql.SaveRecoveryCodeQuery)
+	for i := 0; i < 10; i++ {
+		prepare.ExpectExec().
+			WithArgs("1", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectCommit()
+
+	codes, err := svc.GenerateRecoveryCodes("1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Errorf("expected 10 recovery codes, got %d", len(codes))
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("duplicated recovery code %q", code)
+		}
+		seen[code] = true
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate2FAWithRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("abcdefghij"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUnusedRecoveryCodesQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "code_hash"}).
+			AddRow(3, 1, string(hash)))
+	mock.ExpectPrepare(mysql.MarkRecoveryCodeUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd recovery mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	tokens, err := svc.Validate2FA("1", &dto.OTPDto{RecoveryCode: "ABCDE-FGHIJ"}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens.AccessToken) == 0 {
+		t.Error("Access token should not be empty")
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUnusedRecoveryCodesQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "code_hash"}))
+
+	_, err = svc.Validate2FA("1", &dto.OTPDto{RecoveryCode: "abcde-fghij"}, "127.0.0.1")
+	if !errors.Is(err, service.ErrInvalidRecoveryCode) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidRecoveryCode, err)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+const (
+	revocationCacheTTL  = time.Second * 30
+	revocationCacheSize = 10000
+)
+
+type RevocationRepository interface {
+	// Revoke also purges the revoked tokens that have expired since.
+	Revoke(jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
+	RevokeAllForUser(userID string, before time.Time) error
+	GetRevokedBefore(userID string) (time.Time, error)
+}
+
+type revocationCacheEntry struct {
+	revoked   bool
+	before    time.Time
+	expiresAt time.Time
+}
+
+// RevocationService keeps lookups in an in-process cache for a short time,
+// so revocations made by another instance take up to revocationCacheTTL
+// to be enforced here.
+type RevocationService struct {
+	repo   RevocationRepository
+	mu     sync.Mutex
+	tokens map[string]revocationCacheEntry
+	users  map[string]revocationCacheEntry
+}
+
+func NewRevocationService(repo RevocationRepository) *RevocationService {
+	return &RevocationService{
+		repo:   repo,
+		tokens: make(map[string]revocationCacheEntry),
+		users:  make(map[string]revocationCacheEntry),
+	}
+}
+
+func (s *RevocationService) Revoke(claims *model.Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+	expiresAt := time.Now()
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := s.repo.Revoke(claims.ID, expiresAt); err != nil {
+		return err
+	}
+	s.store(s.tokens, claims.ID, revocationCacheEntry{revoked: true})
+	return nil
+}
+
+// RevokeAll revokes the tokens of the user issued before the current
+// second. Tokens only carry their issue time in seconds, so the ones issued
+// later in the same second, such as the session a password reset starts,
+// stay valid.
+func (s *RevocationService) RevokeAll(userID string) error {
+	before := time.Now().Truncate(time.Second)
+	if err := s.repo.RevokeAllForUser(userID, before); err != nil {
+		return err
+	}
+	s.store(s.users, userID, revocationCacheEntry{before: before})
+	return nil
+}
+
+func (s *RevocationService) IsRevoked(claims *model.Claims) (bool, error) {
+	if claims.ID != "" {
+		entry, ok := s.load(s.tokens, claims.ID)
+		if !ok {
+			revoked, err := s.repo.IsRevoked(claims.ID)
+			if err != nil {
+				return false, err
+			}
+			entry = revocationCacheEntry{revoked: revoked}
+			s.store(s.tokens, claims.ID, entry)
+		}
+		if entry.revoked {
+			return true, nil
+		}
+	}
+	entry, ok := s.load(s.users, claims.Subject)
+	if !ok {
+		before, err := s.repo.GetRevokedBefore(claims.Subject)
+		if err != nil {
+			return false, err
+		}
+		entry = revocationCacheEntry{before: before}
+		s.store(s.users, claims.Subject, entry)
+	}
+	if entry.before.IsZero() || claims.IssuedAt == nil {
+		return false, nil
+	}
+	return claims.IssuedAt.Before(entry.before), nil
+}
+
+func (s *RevocationService) load(cache map[string]revocationCacheEntry, key string) (revocationCacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := cache[key]
+	if !ok {
+		return revocationCacheEntry{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(cache, key)
+		return revocationCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (s *RevocationService) store(cache map[string]revocationCacheEntry, key string, entry revocationCacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(cache) >= revocationCacheSize {
+		for k, e := range cache {
+			if now.After(e.expiresAt) {
+				delete(cache, k)
+			}
+		}
+		// Every entry is still fresh, drop arbitrary ones. They are looked
+		// up in the store again on the next miss.
+		for k := range cache {
+			if len(cache) < revocationCacheSize {
+				break
+			}
+			delete(cache, k)
+		}
+	}
+	entry.expiresAt = now.Add(revocationCacheTTL)
+	cache[key] = entry
+}
@@ -0,0 +1,111 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/memory"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newClaims(jti string, issuedAt time.Time) *model.Claims {
+	return &model.Claims{
+		Scope: model.ScopeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   "1",
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Minute * 15)),
+		},
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	repo := memory.NewRevocationRepository()
+	svc := service.NewRevocationService(repo)
+
+	claims := newClaims("token1", time.Now())
+	revoked, err := svc.IsRevoked(claims)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if revoked {
+		t.Error("token should not be revoked yet")
+	}
+
+	if err := svc.Revoke(claims); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	revoked, err = svc.IsRevoked(claims)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !revoked {
+		t.Error("token should be revoked")
+	}
+
+	// Another instance sharing the same store must see the revocation.
+	revoked, err = service.NewRevocationService(repo).IsRevoked(claims)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !revoked {
+		t.Error("token should be revoked for other instances")
+	}
+}
+
+func TestRevokeAll(t *testing.T) {
+	svc := service.NewRevocationService(memory.NewRevocationRepository())
+
+	old := newClaims("token1", time.Now().Add(-time.Minute))
+	if err := svc.RevokeAll("1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	revoked, err := svc.IsRevoked(old)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !revoked {
+		t.Error("tokens issued before sign-out-all should be revoked")
+	}
+
+	// Issued right after, most likely within the same second.
+	fresh := newClaims("token2", time.Now())
+	revoked, err = svc.IsRevoked(fresh)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if revoked {
+		t.Error("tokens issued after sign-out-all should stay valid")
+	}
+}
+
+func TestRevokePurgesExpiredTokens(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := service.NewRevocationService(mysql.NewRevocationRepository(db))
+
+	claims := newClaims("token1", time.Now())
+	mock.ExpectPrepare(mysql.PurgeRevokedTokensQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectPrepare(mysql.RevokeTokenQuery).
+		ExpectExec().
+		WithArgs("token1", claims.ExpiresAt.Time).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.Revoke(claims); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+// phonePattern matches E.164 numbers.
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+var phoneReplacer = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+
+type SMSSender interface {
+	Send(msg *model.SMSMessage) error
+}
+
+type SMSOTPRepository interface {
+	Save(code *model.SMSOTP) error
+	// GetLatest returns the last code sent to the user, older codes are no
+	// longer valid once a new one is sent.
+	GetLatest(userID string) (*model.SMSOTP, error)
+	// ListSince returns the codes sent to the user after since, oldest
+	// first.
+	ListSince(userID string, since time.Time) ([]*model.SMSOTP, error)
+	MarkUsed(id int64) error
+}
+
+// EnrollSMS2FA texts a code to data.Phone. The number is stored and SMS
+// becomes the second factor once that code is verified. Users that already
+// have 2FA, including those changing their number, must prove their
+// identity first.
+func (s *AuthService) EnrollSMS2FA(userID string, data *dto.SMSEnrollDto, clientIP string) error {
+	phone := phoneReplacer.Replace(data.Phone)
+	if !phonePattern.MatchString(phone) {
+		return ErrInvalidPhone
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireVerifiedEmail(user, config.EmailVerificationEnrollment); err != nil {
+		return err
+	}
+	if user.Valid2FA {
+		if user.MFAMethod == model.MFAMethodSMS && user.Phone == phone {
+			return ErrMFAAlreadyEnabled
+		}
+		if err := s.verifyIdentity(userID, clientIP, user, &data.VerifyIdentityDto); err != nil {
+			return err
+		}
+	}
+	return s.sendSMSOTP(userID, phone, model.OTPEnroll)
+}
+
+// RequestSMSOTP texts a sign-in code to users whose second factor is SMS.
+func (s *AuthService) RequestSMSOTP(userID string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.Valid2FA || user.MFAMethod != model.MFAMethodSMS || !user.PhoneVerified {
+		return ErrSMSOTPNotEnabled
+	}
+	return s.sendSMSOTP(userID, user.Phone, model.OTPVerify)
+}
+
+// VerifySMSOTP confirms a phone enrollment or completes a sign-in with a
+// texted code.
+func (s *AuthService) VerifySMSOTP(userID string, data *dto.OTPDto, clientIP string) (*dto.TokenDto, error) {
+	return s.throttleOTP(userID, clientIP, func() (*dto.TokenDto, error) {
+		user, err := s.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		code, err := s.checkSMSOTP(userID, "", data.Code)
+		if err != nil {
+			return nil, err
+		}
+		if code.Purpose == model.OTPEnroll {
+			return s.confirm2FA(userID, user, func(userID string) error {
+				return s.repo.ActivateSMS2FA(userID, code.Phone)
+			})
+		}
+		if !user.Valid2FA || user.MFAMethod != model.MFAMethodSMS {
+			return nil, ErrInvalidPasscode
+		}
+		return s.issueTokens(userID, "", mfaAMR, time.Now())
+	})
+}
+
+// sendSMSOTP sends at most MaxPerHour codes an hour since every message
+// has a cost.
+func (s *AuthService) sendSMSOTP(userID, phone, purpose string) error {
+	now := time.Now()
+	sent, err := s.smsOTPs.ListSince(userID, now.Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if n := len(sent); n >= s.smsCfg.MaxPerHour {
+		return &LockoutError{RetryAfter: sent[n-s.smsCfg.MaxPerHour].CreatedAt.Add(time.Hour).Sub(now)}
+	}
+	code := &model.SMSOTP{DeliveredCode: model.DeliveredCode{Purpose: purpose}, Phone: phone}
+	return s.smsCodes().deliver(userID, code, func(plain string) error {
+		return s.sms.Send(&model.SMSMessage{
+			To:   phone,
+			Body: fmt.Sprintf("Your %s verification code is %s", s.totpCfg.Issuer, plain),
+		})
+	})
+}
+
+func (s *AuthService) smsCodes() codeDelivery[*model.SMSOTP] {
+	return codeDelivery[*model.SMSOTP]{
+		repo:           s.smsOTPs,
+		ttl:            s.smsCfg.TTL,
+		resendInterval: s.smsCfg.ResendInterval,
+	}
+}
+
+func (s *AuthService) checkSMSOTP(userID, purpose, code string) (*model.SMSOTP, error) {
+	return s.smsCodes().check(userID, purpose, code)
+}
@@ -0,0 +1,193 @@
+package service_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func smsOTPRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "phone", "code_hash", "purpose", "expires_at", "used_at", "created_at"})
+}
+
+func TestEnrollSMS2FA(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	var hash capturedArg
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.ListSMSOTPSinceQuery).
+		ExpectQuery().
+		WithArgs("1", sqlmock.AnyArg()).
+		WillReturnRows(smsOTPRows())
+	mock.ExpectPrepare(mysql.GetLatestSMSOTPQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(smsOTPRows())
+	mock.ExpectPrepare(mysql.SaveSMSOTPQuery).
+		ExpectExec().
+		WithArgs(int64(1), "+14155550123", &hash, "enroll", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+
+	if err := svc.EnrollSMS2FA("1", &dto.SMSEnrollDto{Phone: "+1 (415) 555-0123"}, "127.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	msg := testSMS.Last()
+	if msg == nil || msg.To != "+14155550123" {
+		t.Fatalf("expected a code to be texted to the new phone, got %+v", msg)
+	}
+	code := regexp.MustCompile(`\d{6}$`).FindString(msg.Body)
+	if bcrypt.CompareHashAndPassword([]byte(hash.value), []byte(code)) != nil {
+		t.Fatalf("the texted code %q does not match the stored hash", code)
+	}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetLatestSMSOTPQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(smsOTPRows().
+			AddRow(5, 1, "+14155550123", hash.value, "enroll", time.Now().Add(time.Minute), nil, time.Now()))
+	mock.ExpectPrepare(mysql.MarkSMSOTPUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.ActivateSMS2FAQuery).
+		ExpectExec().
+		WithArgs("+14155550123", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectFirstRecoveryCodes(mock)
+
+	tokens, err := svc.VerifySMSOTP("1", &dto.OTPDto{Code: code}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens.AccessToken) == 0 || len(tokens.RecoveryCodes) != 10 {
+		t.Errorf("expected tokens and recovery codes, got %+v", tokens)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnrollSMS2FARejectsInvalidPhone(t *testing.T) {
+	db, _, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	for _, phone := range []string{"", "4155550123", "+0123456789", "+1415555012345678", "+1415abc0123"} {
+		err := svc.EnrollSMS2FA("1", &dto.SMSEnrollDto{Phone: phone}, "127.0.0.1")
+		if !errors.Is(err, service.ErrInvalidPhone) {
+			t.Errorf("%q: expected error: %v, got %v", phone, service.ErrInvalidPhone, err)
+		}
+	}
+}
+
+func TestRequestSMSOTPRateLimit(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "sms", "+14155550123", true, time.Now(), nil))
+	rows := smsOTPRows()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		sentAt := now.Add(time.Duration(i-55) * time.Minute)
+		rows.AddRow(i+1, 1, "+14155550123", "hash", "verify", sentAt.Add(5*time.Minute), sentAt, sentAt)
+	}
+	mock.ExpectPrepare(mysql.ListSMSOTPSinceQuery).
+		ExpectQuery().
+		WithArgs("1", sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	err = svc.RequestSMSOTP("1")
+	var lockoutErr *service.LockoutError
+	if !errors.As(err, &lockoutErr) {
+		t.Fatalf("expected the hourly limit to be enforced, got %v", err)
+	}
+	if lockoutErr.RetryAfter <= 4*time.Minute || lockoutErr.RetryAfter > 5*time.Minute {
+		t.Errorf("expected to retry once the oldest code leaves the window, got %v", lockoutErr.RetryAfter)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate2FAWithSMSOTP(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "sms", "+14155550123", true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows())
+	mock.ExpectPrepare(mysql.GetLatestSMSOTPQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(smsOTPRows().
+			AddRow(5, 1, "+14155550123", string(hash), "verify", time.Now().Add(time.Minute), nil, time.Now()))
+	mock.ExpectPrepare(mysql.MarkSMSOTPUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	tokens, err := svc.Validate2FA("1", &dto.OTPDto{Code: "123456"}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens.AccessToken) == 0 {
+		t.Error("Access token should not be empty")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+const (
+	accessTokenTTL  = time.Minute * 15
+	refreshTokenTTL = time.Hour * 24 * 30
+)
+
+type RefreshTokenRepository interface {
+	Save(t *model.RefreshToken) error
+	GetByHash(hash string) (*model.RefreshToken, error)
+	MarkUsed(id int64) error
+	RevokeFamily(familyID string) error
+	RevokeAllForUser(userID string) error
+}
+
+// RefreshToken rotates the presented refresh token. Presenting a token that
+// was already rotated revokes every token issued from the same sign-in.
+func (s *AuthService) RefreshToken(data *dto.RefreshTokenDto) (*dto.TokenDto, error) {
+	return s.rotateRefreshToken(data.RefreshToken, "")
+}
+
+// rotateRefreshToken rotates a refresh token issued to clientID, empty for
+// first-party sign ins. Tokens of another client are rejected before they
+// can mark or revoke anything.
+func (s *AuthService) rotateRefreshToken(token, clientID string) (*dto.TokenDto, error) {
+	current, err := s.tokenRepo.GetByHash(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if current.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+	if current.UsedAt != nil {
+		return nil, s.revokeFamily(current.FamilyID)
+	}
+	if err := s.tokenRepo.MarkUsed(current.ID); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			return nil, s.revokeFamily(current.FamilyID)
+		}
+		return nil, err
+	}
+	return s.issueClientTokens(strconv.FormatInt(current.UserID, 10), current.FamilyID, current.ClientID, current.Scope, current.AMR, current.AuthTime)
+}
+
+func (s *AuthService) SignOut(claims *model.Claims) error {
+	if err := s.revocations.Revoke(claims); err != nil {
+		return err
+	}
+	if claims.SessionID == "" {
+		return nil
+	}
+	return s.tokenRepo.RevokeFamily(claims.SessionID)
+}
+
+func (s *AuthService) SignOutAll(userID string) error {
+	if err := s.revocations.RevokeAll(userID); err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeAllForUser(userID)
+}
+
+func (s *AuthService) revokeFamily(familyID string) error {
+	if err := s.tokenRepo.RevokeFamily(familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// issueTokens mints an access token and a refresh token. An empty familyID
+// starts a new token family. amr and authTime describe how and when the
+// user signed in, they are kept on the refresh token so rotated access
+// tokens report the original authentication.
+func (s *AuthService) issueTokens(userID, familyID string, amr []string, authTime time.Time) (*dto.TokenDto, error) {
+	return s.issueClientTokens(userID, familyID, "", "", amr, authTime)
+}
+
+// issueClientTokens is issueTokens for the OAuth client clientID, which the
+// user granted scope. Both are kept on the refresh token family.
+func (s *AuthService) issueClientTokens(userID, familyID, clientID, scope string, amr []string, authTime time.Time) (*dto.TokenDto, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if familyID == "" {
+		familyID, err = randomToken(16)
+		if err != nil {
+			return nil, err
+		}
+	}
+	accessToken, err := s.generateAccessToken(userID, familyID, clientID, scope, amr, authTime)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tokenRepo.Save(&model.RefreshToken{
+		UserID:    id,
+		FamilyID:  familyID,
+		ClientID:  clientID,
+		Scope:     scope,
+		TokenHash: hashToken(refreshToken),
+		AMR:       amr,
+		AuthTime:  authTime,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dto.TokenDto{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,117 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func refreshTokenRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "family_id", "token_hash", "amr", "auth_time", "expires_at", "used_at", "revoked_at", "client_id", "scope"})
+}
+
+func TestRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	hash := hashRefreshToken("refresh123")
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+		ExpectQuery().
+		WithArgs(hash).
+		WillReturnRows(refreshTokenRows().
+			AddRow(7, 1, "family1", hash, "pwd otp mfa", authTime, time.Now().Add(time.Hour), nil, nil, nil, ""))
+	mock.ExpectPrepare(mysql.MarkRefreshTokenUsedQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, "family1", sqlmock.AnyArg(), "pwd otp mfa", authTime, sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(8, 1))
+
+	tokens, err := svc.RefreshToken(&dto.RefreshTokenDto{RefreshToken: "refresh123"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var claims model.Claims
+	if _, err := jwt.ParseWithClaims(tokens.AccessToken, &claims, testKeys.Keyfunc); err != nil {
+		t.Fatalf("unexpected error parsing token: %v", err)
+	}
+	if claims.ACR != model.ACRMFA || claims.AuthTime == nil || !claims.AuthTime.Equal(authTime) {
+		t.Errorf("expected the original authentication to be kept, got acr %q and auth_time %v", claims.ACR, claims.AuthTime)
+	}
+	if len(tokens.RefreshToken) == 0 || tokens.RefreshToken == "refresh123" {
+		t.Error("Refresh token should be rotated")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	hash := hashRefreshToken("refresh123")
+	mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+		ExpectQuery().
+		WithArgs(hash).
+		WillReturnRows(refreshTokenRows().
+			AddRow(7, 1, "family1", hash, "pwd otp mfa", time.Now(), time.Now().Add(time.Hour), time.Now(), nil, nil, ""))
+	mock.ExpectPrepare(mysql.RevokeRefreshTokenFamilyQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "family1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	_, err = svc.RefreshToken(&dto.RefreshTokenDto{RefreshToken: "refresh123"})
+	if !errors.Is(err, service.ErrRefreshTokenReused) {
+		t.Errorf("expected error: %v, got %v", service.ErrRefreshTokenReused, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	hash := hashRefreshToken("refresh123")
+	mock.ExpectPrepare(mysql.GetRefreshTokenByHashQuery).
+		ExpectQuery().
+		WithArgs(hash).
+		WillReturnRows(refreshTokenRows().
+			AddRow(7, 1, "family1", hash, "pwd otp mfa", time.Now(), time.Now().Add(-time.Hour), nil, nil, nil, ""))
+
+	_, err = svc.RefreshToken(&dto.RefreshTokenDto{RefreshToken: "refresh123"})
+	if !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidRefreshToken, err)
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const maxDeviceNameLength = 255
+
+var trustedDeviceAMR = []string{model.AMRPassword, model.AMRTrustedDevice, model.AMRMFA}
+
+type TrustedDeviceRepository interface {
+	Save(device *model.TrustedDevice) error
+	GetByHash(hash string) (*model.TrustedDevice, error)
+	// GetByUserID returns the devices of the user that have not expired.
+	GetByUserID(userID string) ([]*model.TrustedDevice, error)
+	Touch(id int64) error
+	Delete(userID string, id int64) error
+	DeleteAll(userID string) error
+}
+
+func (s *AuthService) ListTrustedDevices(userID string) ([]dto.TrustedDeviceDto, error) {
+	devices, err := s.devices.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]dto.TrustedDeviceDto, 0, len(devices))
+	for _, d := range devices {
+		list = append(list, dto.TrustedDeviceDto{
+			ID:         d.ID,
+			Name:       d.Name,
+			CreatedAt:  d.CreatedAt,
+			ExpiresAt:  d.ExpiresAt,
+			LastUsedAt: d.LastUsedAt,
+		})
+	}
+	return list, nil
+}
+
+func (s *AuthService) RevokeTrustedDevice(userID string, id int64) error {
+	return s.devices.Delete(userID, id)
+}
+
+func (s *AuthService) RevokeTrustedDevices(userID string) error {
+	return s.devices.DeleteAll(userID)
+}
+
+// trustDevice remembers the device the user just passed 2FA on and returns
+// its device token. The token is a signed JWT that is only valid while its
+// row exists, so revoking the device revokes the token.
+func (s *AuthService) trustDevice(userID, name string) (string, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	token, err := s.generateToken(userID, s.deviceCfg.TTL, model.Claims{
+		Scope: model.ScopeTrustedDevice,
+	})
+	if err != nil {
+		return "", err
+	}
+	err = s.devices.Save(&model.TrustedDevice{
+		UserID:    id,
+		TokenHash: hashToken(token),
+		Name:      deviceName(name),
+		ExpiresAt: time.Now().Add(s.deviceCfg.TTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// checkTrustedDevice accepts a device token issued to userID that has been
+// neither revoked nor expired.
+func (s *AuthService) checkTrustedDevice(userID, token string) error {
+	var claims model.Claims
+	parsed, err := jwt.ParseWithClaims(token, &claims, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.Methods()))
+	if err != nil || !parsed.Valid || claims.Scope != model.ScopeTrustedDevice || claims.Subject != userID {
+		return ErrInvalidDeviceToken
+	}
+	device, err := s.devices.GetByHash(hashToken(token))
+	if err != nil {
+		return err
+	}
+	if fmt.Sprint(device.UserID) != userID || !time.Now().Before(device.ExpiresAt) {
+		return ErrInvalidDeviceToken
+	}
+	return s.devices.Touch(device.ID)
+}
+
+// deviceName cuts name, usually a User-Agent, down to what fits the
+// trusted_devices table.
+func deviceName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Unknown device"
+	}
+	runes := []rune(name)
+	if len(runes) > maxDeviceNameLength {
+		name = string(runes[:maxDeviceNameLength])
+	}
+	return name
+}
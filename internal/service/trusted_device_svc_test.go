@@ -0,0 +1,214 @@
+package service_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp/totp"
+)
+
+func trustedDeviceRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "token_hash", "name", "created_at", "expires_at", "last_used_at"})
+}
+
+func expectSignInWith2FA(mock sqlmock.Sqlmock) {
+	mock.ExpectPrepare(mysql.GetUserByEmailQuery).
+		ExpectQuery().
+		WithArgs("santiago@google.com").
+		WillReturnRows(userByEmailRows().
+			AddRow(1, "santiago@google.com", "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK", true, "totp", time.Now(), nil))
+}
+
+func TestSignInWithTrustedDevice(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "otp-api", AccountName: "santiago@google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokenHash capturedArg
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", true, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", key.Secret(), "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.SetFactorLastOTPAtQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectPrepare(mysql.SaveTrustedDeviceQuery).
+		ExpectExec().
+		WithArgs(1, &tokenHash, "Firefox on Linux", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+
+	tokens, err := svc.Validate2FA("1", &dto.OTPDto{Code: code, RememberDevice: true, DeviceName: "Firefox on Linux"}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tokens.DeviceToken == "" || tokens.AccessToken == "" {
+		t.Fatalf("expected access and device tokens, got %+v", tokens)
+	}
+
+	expectSignInWith2FA(mock)
+	mock.ExpectPrepare(mysql.GetTrustedDeviceByHashQuery).
+		ExpectQuery().
+		WithArgs(&tokenHash).
+		WillReturnRows(trustedDeviceRows().
+			AddRow(4, 1, tokenHash.value, "Firefox on Linux", time.Now(), time.Now().Add(time.Hour), nil))
+	mock.ExpectPrepare(mysql.TouchTrustedDeviceQuery).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd device mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	signedIn, err := svc.SignIn(&dto.SignInDto{
+		Email:       "santiago@google.com",
+		Password:    "santiago123",
+		DeviceToken: tokens.DeviceToken,
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signedIn.MFARequired || signedIn.AccessToken == "" {
+		t.Errorf("expected the trusted device to skip 2FA, got %+v", signedIn)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignInWithRevokedDevice(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	token, err := testKeys.Sign(model.Claims{
+		Scope: model.ScopeTrustedDevice,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectSignInWith2FA(mock)
+	mock.ExpectPrepare(mysql.GetTrustedDeviceByHashQuery).
+		ExpectQuery().
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnError(sql.ErrNoRows)
+
+	tokens, err := svc.SignIn(&dto.SignInDto{
+		Email:       "santiago@google.com",
+		Password:    "santiago123",
+		DeviceToken: token,
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !tokens.MFARequired || tokens.AccessToken != "" {
+		t.Errorf("expected a revoked device to still require 2FA, got %+v", tokens)
+	}
+
+	expectSignInWith2FA(mock)
+	tokens, err = svc.SignIn(&dto.SignInDto{
+		Email:       "santiago@google.com",
+		Password:    "santiago123",
+		DeviceToken: "not-a-token",
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !tokens.MFARequired {
+		t.Error("expected an invalid device token to require 2FA")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListTrustedDevices(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.GetUserTrustedDevicesQuery).
+		ExpectQuery().
+		WithArgs("1", sqlmock.AnyArg()).
+		WillReturnRows(trustedDeviceRows().
+			AddRow(4, 1, "hash4", "Firefox on Linux", time.Now(), time.Now().Add(time.Hour), time.Now()).
+			AddRow(5, 1, "hash5", "Safari on iPhone", time.Now(), time.Now().Add(time.Hour), nil))
+
+	devices, err := svc.ListTrustedDevices("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(devices) != 2 || devices[0].LastUsedAt == nil || devices[1].Name != "Safari on iPhone" {
+		t.Errorf("unexpected devices: %+v", devices)
+	}
+}
+
+func TestRevokeTrustedDevice(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newAuthService(db)
+
+	mock.ExpectPrepare(mysql.DeleteTrustedDeviceQuery).
+		ExpectExec().
+		WithArgs(9, "1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := svc.RevokeTrustedDevice("1", 9); !errors.Is(err, service.ErrTrustedDeviceNotFound) {
+		t.Errorf("expected error: %v, got %v", service.ErrTrustedDeviceNotFound, err)
+	}
+
+	mock.ExpectPrepare(mysql.DeleteTrustedDeviceQuery).
+		ExpectExec().
+		WithArgs(4, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.RevokeTrustedDevice("1", 4); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
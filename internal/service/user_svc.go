@@ -1,14 +1,24 @@
 package service
 
-import "github.com/SantiagoBedoya/otp-api/internal/model"
+import (
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
 
 type UserRepository interface {
 	GetAll() ([]model.User, error)
 	GetByEmail(email string) (*model.User, error)
 	GetByID(userID string) (*model.User, error)
+	GetProfile(userID string) (*model.User, error)
 	Save(u *model.User) error
-	SaveSecret(userID, secret string) error
-	SetValidSecret(userID string) error
+	Enable2FA(userID, method string) error
+	ActivateSMS2FA(userID, phone string) error
+	Disable2FA(userID string) error
+	UpdatePassword(userID, hash string) error
+	UpdateEmail(userID, email string) error
+	SetEmailVerificationSent(userID string, sentAt time.Time) error
+	MarkEmailVerified(userID, email string) error
 }
 
 type UserService struct {
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/webauthn"
+)
+
+const publicKeyCredentialType = "public-key"
+
+var (
+	webAuthnAMR = []string{model.AMRPassword, model.AMRHardwareKey, model.AMRMFA}
+	// A passkey is something the user has, unlocked by something they
+	// know or are, so it is multi-factor on its own.
+	passkeyAMR = []string{model.AMRHardwareKey, model.AMRMFA}
+)
+
+type WebAuthnCredentialRepository interface {
+	Save(c *model.WebAuthnCredential) error
+	GetByCredentialID(credentialID []byte) (*model.WebAuthnCredential, error)
+	GetByUserID(userID string) ([]*model.WebAuthnCredential, error)
+	UpdateSignCount(id int64, previous, signCount uint32) error
+	Rename(userID string, id int64, name string) error
+	Delete(userID string, id int64) error
+	DeleteAll(userID string) error
+}
+
+type WebAuthnChallengeRepository interface {
+	Save(c *model.WebAuthnChallenge) error
+	GetByHash(hash string) (*model.WebAuthnChallenge, error)
+	Delete(id int64) error
+}
+
+// WebAuthnService registers security keys and passkeys and uses them as a
+// second factor or to sign in without a password.
+type WebAuthnService struct {
+	auth        *AuthService
+	credentials WebAuthnCredentialRepository
+	challenges  WebAuthnChallengeRepository
+	rp          *webauthn.RelyingParty
+	cfg         config.WebAuthn
+}
+
+func NewWebAuthnService(auth *AuthService, credentials WebAuthnCredentialRepository, challenges WebAuthnChallengeRepository, cfg config.WebAuthn) *WebAuthnService {
+	return &WebAuthnService{
+		auth:        auth,
+		credentials: credentials,
+		challenges:  challenges,
+		rp: &webauthn.RelyingParty{
+			ID:      cfg.RPID,
+			Name:    cfg.RPName,
+			Origins: cfg.Origins,
+		},
+		cfg: cfg,
+	}
+}
+
+// BeginRegistration returns the options for navigator.credentials.create.
+func (s *WebAuthnService) BeginRegistration(userID string) (*dto.CredentialCreationOptionsDto, error) {
+	user, err := s.auth.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.auth.requireVerifiedEmail(user, config.EmailVerificationEnrollment); err != nil {
+		return nil, err
+	}
+	creds, err := s.credentials.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.newChallenge(userID, model.WebAuthnRegister)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]dto.CredentialParameterDto, len(webauthn.SupportedAlgorithms))
+	for i, alg := range webauthn.SupportedAlgorithms {
+		params[i] = dto.CredentialParameterDto{Type: publicKeyCredentialType, Alg: alg}
+	}
+	return &dto.CredentialCreationOptionsDto{
+		Challenge: challenge,
+		RP:        dto.RelyingPartyDto{ID: s.rp.ID, Name: s.rp.Name},
+		User: dto.WebAuthnUserDto{
+			ID:          webauthn.EncodeBase64URL([]byte(userID)),
+			Name:        user.Email,
+			DisplayName: user.Email,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            s.cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: credentialDescriptors(creds),
+		AuthenticatorSelection: dto.AuthenticatorSelectionDto{
+			ResidentKey:      "preferred",
+			UserVerification: s.cfg.UserVerification,
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishRegistration stores the new credential and makes WebAuthn the
+// second factor of the user.
+func (s *WebAuthnService) FinishRegistration(userID string, data *dto.PublicKeyCredentialDto) (*dto.TokenDto, error) {
+	clientData, err := webauthn.DecodeBase64URL(data.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	attestation, err := webauthn.DecodeBase64URL(data.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	challenge, err := s.takeChallenge(clientData, userID, model.WebAuthnRegister)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := s.rp.VerifyRegistration(challenge, clientData, attestation, s.cfg.UserVerification == "required")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	err = s.credentials.Save(&model.WebAuthnCredential{
+		UserID:       id,
+		Name:         "Security key",
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		Transports:   data.Response.Transports,
+	})
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.auth.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.confirm2FA(userID, user, func(userID string) error {
+		return s.auth.repo.Enable2FA(userID, model.MFAMethodWebAuthn)
+	})
+}
+
+// BeginLogin returns the options for navigator.credentials.get when a
+// credential is used as the second factor.
+func (s *WebAuthnService) BeginLogin(userID string) (*dto.CredentialRequestOptionsDto, error) {
+	creds, err := s.credentials.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		return nil, ErrNoWebAuthnCredentials
+	}
+	return s.requestOptions(userID, model.WebAuthnLogin, creds, s.cfg.UserVerification)
+}
+
+// FinishLogin completes the sign-in of userID with one of their
+// credentials.
+func (s *WebAuthnService) FinishLogin(userID string, data *dto.PublicKeyCredentialDto) (*dto.TokenDto, error) {
+	if _, err := s.verifyAssertion(userID, model.WebAuthnLogin, data, s.cfg.UserVerification == "required"); err != nil {
+		return nil, err
+	}
+	return s.auth.issueTokens(userID, "", webAuthnAMR, time.Now())
+}
+
+// BeginPasskeyLogin returns the options to sign in with a discoverable
+// credential, without a password.
+func (s *WebAuthnService) BeginPasskeyLogin() (*dto.CredentialRequestOptionsDto, error) {
+	return s.requestOptions("", model.WebAuthnPasskey, nil, "required")
+}
+
+// FinishPasskeyLogin signs in the owner of the credential. User
+// verification is required since the passkey replaces the password.
+func (s *WebAuthnService) FinishPasskeyLogin(data *dto.PublicKeyCredentialDto) (*dto.TokenDto, error) {
+	cred, err := s.verifyAssertion("", model.WebAuthnPasskey, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.issueTokens(fmt.Sprint(cred.UserID), "", passkeyAMR, time.Now())
+}
+
+// ListCredentials returns the security keys and passkeys of the user.
+func (s *WebAuthnService) ListCredentials(userID string) ([]dto.WebAuthnCredentialDto, error) {
+	creds, err := s.credentials.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]dto.WebAuthnCredentialDto, 0, len(creds))
+	for _, c := range creds {
+		list = append(list, dto.WebAuthnCredentialDto{
+			ID:         c.ID,
+			Name:       c.Name,
+			Transports: c.Transports,
+			CreatedAt:  c.CreatedAt,
+			LastUsedAt: c.LastUsedAt,
+		})
+	}
+	return list, nil
+}
+
+// DeleteCredential removes a security key or passkey after the user proves
+// their identity, see AuthService.DeleteFactor.
+func (s *WebAuthnService) DeleteCredential(userID string, id int64, data *dto.VerifyIdentityDto, clientIP string) error {
+	return s.auth.DeleteFactor(userID, model.MFAMethodWebAuthn, id, data, clientIP)
+}
+
+func (s *WebAuthnService) requestOptions(userID, ceremony string, creds []*model.WebAuthnCredential, userVerification string) (*dto.CredentialRequestOptionsDto, error) {
+	challenge, err := s.newChallenge(userID, ceremony)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.CredentialRequestOptionsDto{
+		Challenge:        challenge,
+		Timeout:          s.cfg.Timeout.Milliseconds(),
+		RPID:             s.rp.ID,
+		AllowCredentials: credentialDescriptors(creds),
+		UserVerification: userVerification,
+	}, nil
+}
+
+// verifyAssertion checks the signature of a credential owned by userID, or
+// by anyone when userID is empty, and moves its signature counter.
+func (s *WebAuthnService) verifyAssertion(userID, ceremony string, data *dto.PublicKeyCredentialDto, requireUV bool) (*model.WebAuthnCredential, error) {
+	rawID, err := webauthn.DecodeBase64URL(data.RawID)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	clientData, err := webauthn.DecodeBase64URL(data.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	authData, err := webauthn.DecodeBase64URL(data.Response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	signature, err := webauthn.DecodeBase64URL(data.Response.Signature)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	challenge, err := s.takeChallenge(clientData, userID, ceremony)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := s.credentials.GetByCredentialID(rawID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != "" && fmt.Sprint(cred.UserID) != userID {
+		return nil, ErrInvalidCredential
+	}
+	if data.Response.UserHandle != "" {
+		handle, err := webauthn.DecodeBase64URL(data.Response.UserHandle)
+		if err != nil || !bytes.Equal(handle, []byte(fmt.Sprint(cred.UserID))) {
+			return nil, ErrInvalidCredential
+		}
+	}
+	authenticator, err := s.rp.VerifyAssertion(challenge, cred.PublicKey, clientData, authData, signature, requireUV)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+	// Authenticators that keep a counter must move it forward, a counter
+	// that does not suggests the credential was cloned.
+	if authenticator.SignCount != 0 || cred.SignCount != 0 {
+		if authenticator.SignCount <= cred.SignCount {
+			return nil, ErrCredentialCloned
+		}
+	}
+	if err := s.credentials.UpdateSignCount(cred.ID, cred.SignCount, authenticator.SignCount); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+func (s *WebAuthnService) newChallenge(userID, ceremony string) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	encoded := webauthn.EncodeBase64URL(challenge)
+	c := &model.WebAuthnChallenge{
+		ChallengeHash: hashToken(encoded),
+		Ceremony:      ceremony,
+		ExpiresAt:     time.Now().Add(s.cfg.Timeout),
+	}
+	if userID != "" {
+		if c.UserID, err = strconv.ParseInt(userID, 10, 64); err != nil {
+			return "", err
+		}
+	}
+	if err := s.challenges.Save(c); err != nil {
+		return "", err
+	}
+	return encoded, nil
+}
+
+// takeChallenge finds the challenge echoed in clientDataJSON and deletes
+// it, so it cannot be answered twice even if the ceremony then fails.
+func (s *WebAuthnService) takeChallenge(clientDataJSON []byte, userID, ceremony string) ([]byte, error) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	challenge, err := clientData.ChallengeBytes()
+	if err != nil {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+	stored, err := s.challenges.GetByHash(hashToken(webauthn.EncodeBase64URL(challenge)))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.challenges.Delete(stored.ID); err != nil {
+		return nil, err
+	}
+	owner := ""
+	if stored.UserID != 0 {
+		owner = fmt.Sprint(stored.UserID)
+	}
+	if stored.Ceremony != ceremony || owner != userID || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+	return challenge, nil
+}
+
+func credentialDescriptors(creds []*model.WebAuthnCredential) []dto.CredentialDescriptorDto {
+	descriptors := make([]dto.CredentialDescriptorDto, len(creds))
+	for i, cred := range creds {
+		descriptors[i] = dto.CredentialDescriptorDto{
+			Type:       publicKeyCredentialType,
+			ID:         webauthn.EncodeBase64URL(cred.CredentialID),
+			Transports: cred.Transports,
+		}
+	}
+	return descriptors
+}
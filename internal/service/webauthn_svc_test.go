@@ -0,0 +1,422 @@
+package service_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/dto"
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/repository/mysql"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+	"github.com/SantiagoBedoya/otp-api/internal/webauthn"
+	"github.com/SantiagoBedoya/otp-api/internal/webauthn/webauthntest"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newWebAuthnService(db *sql.DB) *service.WebAuthnService {
+	return service.NewWebAuthnService(
+		newAuthService(db),
+		mysql.NewWebAuthnCredentialRepository(db),
+		mysql.NewWebAuthnChallengeRepository(db),
+		config.DefaultWebAuthn(),
+	)
+}
+
+func newTestAuthenticator() *webauthntest.Authenticator {
+	cfg := config.DefaultWebAuthn()
+	return webauthntest.NewAuthenticator(cfg.RPID, cfg.Origins[0])
+}
+
+func webAuthnCredentialRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "name", "credential_id", "public_key", "sign_count", "transports", "created_at", "last_used_at"})
+}
+
+func webAuthnChallengeRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "challenge_hash", "ceremony", "expires_at"})
+}
+
+// expectChallenge expects the challenge of options to be looked up and
+// consumed.
+func expectChallenge(mock sqlmock.Sqlmock, hash *capturedArg, userID any, ceremony string) {
+	mock.ExpectPrepare(mysql.GetWebAuthnChallengeQuery).
+		ExpectQuery().
+		WithArgs(hash.value).
+		WillReturnRows(webAuthnChallengeRows().
+			AddRow(3, userID, hash.value, ceremony, time.Now().Add(time.Minute)))
+	mock.ExpectPrepare(mysql.DeleteWebAuthnChallengeQuery).
+		ExpectExec().
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func decodeChallenge(t *testing.T, challenge string) []byte {
+	b, err := webauthn.DecodeBase64URL(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func assertionDto(authenticator *webauthntest.Authenticator, challenge []byte, userHandle string) *dto.PublicKeyCredentialDto {
+	clientData, authData, sig := authenticator.Get(challenge)
+	id := webauthn.EncodeBase64URL(authenticator.CredentialID)
+	return &dto.PublicKeyCredentialDto{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: dto.AuthenticatorResponseDto{
+			ClientDataJSON:    webauthn.EncodeBase64URL(clientData),
+			AuthenticatorData: webauthn.EncodeBase64URL(authData),
+			Signature:         webauthn.EncodeBase64URL(sig),
+			UserHandle:        userHandle,
+		},
+	}
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newWebAuthnService(db)
+	authenticator := newTestAuthenticator()
+
+	var hash capturedArg
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows())
+	mock.ExpectPrepare(mysql.SaveWebAuthnChallengeQuery).
+		ExpectExec().
+		WithArgs(1, &hash, model.WebAuthnRegister, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	options, err := svc.BeginRegistration("1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if options.RP.ID != "localhost" || options.User.Name != "santiago@google.com" || options.Attestation != "none" {
+		t.Errorf("unexpected creation options: %+v", options)
+	}
+
+	clientData, attestation := authenticator.Create(decodeChallenge(t, options.Challenge))
+	expectChallenge(mock, &hash, 1, model.WebAuthnRegister)
+	mock.ExpectPrepare(mysql.SaveWebAuthnCredentialQuery).
+		ExpectExec().
+		WithArgs(1, "Security key", authenticator.CredentialID, authenticator.PublicKey(), 0, "usb").
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", "hash123", false, "totp", nil, false, time.Now(), nil))
+	mock.ExpectPrepare(mysql.Enable2FAQuery).
+		ExpectExec().
+		WithArgs("webauthn", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectFirstRecoveryCodes(mock)
+
+	id := webauthn.EncodeBase64URL(authenticator.CredentialID)
+	tokens, err := svc.FinishRegistration("1", &dto.PublicKeyCredentialDto{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: dto.AuthenticatorResponseDto{
+			ClientDataJSON:    webauthn.EncodeBase64URL(clientData),
+			AttestationObject: webauthn.EncodeBase64URL(attestation),
+			Transports:        []string{"usb"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens.AccessToken) == 0 || len(tokens.RecoveryCodes) != 10 {
+		t.Errorf("expected tokens and recovery codes, got %+v", tokens)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newWebAuthnService(db)
+	authenticator := newTestAuthenticator()
+
+	var hash capturedArg
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(7, 1, "Security key", authenticator.CredentialID, authenticator.PublicKey(), 0, "usb", time.Now(), nil))
+	mock.ExpectPrepare(mysql.SaveWebAuthnChallengeQuery).
+		ExpectExec().
+		WithArgs(1, &hash, model.WebAuthnLogin, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	options, err := svc.BeginLogin("1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(options.AllowCredentials) != 1 || options.AllowCredentials[0].ID != webauthn.EncodeBase64URL(authenticator.CredentialID) {
+		t.Errorf("expected the registered credential to be allowed, got %+v", options.AllowCredentials)
+	}
+
+	data := assertionDto(authenticator, decodeChallenge(t, options.Challenge), "")
+	expectChallenge(mock, &hash, 1, model.WebAuthnLogin)
+	mock.ExpectPrepare(mysql.GetWebAuthnCredentialQuery).
+		ExpectQuery().
+		WithArgs(authenticator.CredentialID).
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(7, 1, "Security key", authenticator.CredentialID, authenticator.PublicKey(), 0, "usb", time.Now(), nil))
+	mock.ExpectPrepare(mysql.UpdateWebAuthnCredentialSignCountQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), 7, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd hwk mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	tokens, err := svc.FinishLogin("1", data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var claims model.Claims
+	if _, err := jwt.ParseWithClaims(tokens.AccessToken, &claims, testKeys.Keyfunc); err != nil {
+		t.Fatalf("unexpected error parsing token: %v", err)
+	}
+	if claims.ACR != model.ACRMFA || !model.HasAMR(claims.AMR, model.AMRHardwareKey) {
+		t.Errorf("expected a multi-factor sign-in with a hardware key, got acr %q and amr %v", claims.ACR, claims.AMR)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebAuthnLoginRejectsClonedCredential(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newWebAuthnService(db)
+	authenticator := newTestAuthenticator()
+	authenticator.SignCount = 4
+
+	var hash capturedArg
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(7, 1, "Security key", authenticator.CredentialID, authenticator.PublicKey(), 9, "", time.Now(), nil))
+	mock.ExpectPrepare(mysql.SaveWebAuthnChallengeQuery).
+		ExpectExec().
+		WithArgs(1, &hash, model.WebAuthnLogin, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	options, err := svc.BeginLogin("1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data := assertionDto(authenticator, decodeChallenge(t, options.Challenge), "")
+	expectChallenge(mock, &hash, 1, model.WebAuthnLogin)
+	mock.ExpectPrepare(mysql.GetWebAuthnCredentialQuery).
+		ExpectQuery().
+		WithArgs(authenticator.CredentialID).
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(7, 1, "Security key", authenticator.CredentialID, authenticator.PublicKey(), 9, "", time.Now(), nil))
+
+	_, err = svc.FinishLogin("1", data)
+	if !errors.Is(err, service.ErrCredentialCloned) {
+		t.Errorf("expected error: %v, got %v", service.ErrCredentialCloned, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newWebAuthnService(db)
+	authenticator := newTestAuthenticator()
+
+	var hash capturedArg
+	mock.ExpectPrepare(mysql.SaveWebAuthnChallengeQuery).
+		ExpectExec().
+		WithArgs(nil, &hash, model.WebAuthnPasskey, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	options, err := svc.BeginPasskeyLogin()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(options.AllowCredentials) != 0 || options.UserVerification != "required" {
+		t.Errorf("unexpected request options: %+v", options)
+	}
+
+	data := assertionDto(authenticator, decodeChallenge(t, options.Challenge), webauthn.EncodeBase64URL([]byte("1")))
+	expectChallenge(mock, &hash, nil, model.WebAuthnPasskey)
+	mock.ExpectPrepare(mysql.GetWebAuthnCredentialQuery).
+		ExpectQuery().
+		WithArgs(authenticator.CredentialID).
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(7, 1, "Security key", authenticator.CredentialID, authenticator.PublicKey(), 0, "internal", time.Now(), nil))
+	mock.ExpectPrepare(mysql.UpdateWebAuthnCredentialSignCountQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), 7, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.SaveRefreshTokenQuery).
+		ExpectExec().
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "hwk mfa", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	tokens, err := svc.FinishPasskeyLogin(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens.AccessToken) == 0 {
+		t.Error("Access token should not be empty")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasskeyLoginRejectsReplayedChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newWebAuthnService(db)
+	authenticator := newTestAuthenticator()
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectPrepare(mysql.GetWebAuthnChallengeQuery).
+		ExpectQuery().
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(webAuthnChallengeRows())
+
+	_, err = svc.FinishPasskeyLogin(assertionDto(authenticator, challenge, ""))
+	if !errors.Is(err, service.ErrInvalidWebAuthnChallenge) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidWebAuthnChallenge, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteWebAuthnCredential(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error opening stub db connection: %v", err)
+	}
+	defer db.Close()
+	svc := newWebAuthnService(db)
+	authenticator := newTestAuthenticator()
+
+	hash := "$2a$10$DwfxEpjq0gE2YW3OcWUF9eOQJzfdrkvRN8j3O06Olbm2ng6wNcpMK"
+	recoveryHash, err := bcrypt.GenerateFromPassword([]byte("abcdefghij"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecoveryIdentity := func() {
+		mock.ExpectPrepare(mysql.GetUserByIDQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(userByIDRows().
+				AddRow("santiago@google.com", hash, true, "webauthn", nil, false, time.Now(), nil))
+		mock.ExpectPrepare(mysql.GetUnusedRecoveryCodesQuery).
+			ExpectQuery().
+			WithArgs("1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "code_hash"}).
+				AddRow(3, 1, string(recoveryHash)))
+		mock.ExpectPrepare(mysql.MarkRecoveryCodeUsedQuery).
+			ExpectExec().
+			WithArgs(sqlmock.AnyArg(), 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	identity := &dto.VerifyIdentityDto{Password: "santiago123", RecoveryCode: "abcde-fghij"}
+
+	mock.ExpectPrepare(mysql.GetUserByIDQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(userByIDRows().
+			AddRow("santiago@google.com", hash, true, "webauthn", nil, false, time.Now(), nil))
+	err = svc.DeleteCredential("1", 7, &dto.VerifyIdentityDto{Password: "wrong"}, "127.0.0.1")
+	if !errors.Is(err, service.ErrInvalidPassword) {
+		t.Errorf("expected error: %v, got %v", service.ErrInvalidPassword, err)
+	}
+
+	// The credential of another user.
+	expectRecoveryIdentity()
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows())
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(7, 1, "Security key", authenticator.CredentialID, authenticator.PublicKey(), 0, "usb", time.Now(), nil))
+	err = svc.DeleteCredential("1", 8, identity, "127.0.0.1")
+	if !errors.Is(err, service.ErrFactorNotFound) {
+		t.Errorf("expected error: %v, got %v", service.ErrFactorNotFound, err)
+	}
+
+	// Deleting the only security key leaves the authenticator app to sign
+	// in with.
+	expectRecoveryIdentity()
+	mock.ExpectPrepare(mysql.GetUserFactorsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(factorRows().
+			AddRow(1, 1, "totp", "Phone", "JBSWY3DPEHPK3PXP", "SHA1", 6, 30, 0, 0, true, time.Now(), nil))
+	mock.ExpectPrepare(mysql.GetUserWebAuthnCredentialsQuery).
+		ExpectQuery().
+		WithArgs("1").
+		WillReturnRows(webAuthnCredentialRows().
+			AddRow(7, 1, "Security key", authenticator.CredentialID, authenticator.PublicKey(), 0, "usb", time.Now(), nil))
+	mock.ExpectPrepare(mysql.Enable2FAQuery).
+		ExpectExec().
+		WithArgs("totp", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(mysql.DeleteWebAuthnCredentialQuery).
+		ExpectExec().
+		WithArgs(7, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.DeleteCredential("1", 7, identity, "127.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
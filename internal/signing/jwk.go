@@ -0,0 +1,65 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public part of every asymmetric key. Shared HMAC
+// secrets are never published.
+func (s *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(s.ordered))}
+	for _, key := range s.Keys() {
+		jwk, ok := key.JWK()
+		if ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (k *Key) JWK() (JWK, bool) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(pub.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encode(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = encode(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encode(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKey        = errors.New("signing key is not known")
+	ErrUnsupportedKey    = errors.New("unsupported key type")
+	ErrMissingSigningKey = errors.New("signing key has no private part")
+)
+
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// signingKey is nil for keys that are only kept to verify tokens.
+	signingKey interface{}
+	verifyKey  interface{}
+}
+
+// NewKey wraps a private or public RSA, ECDSA or Ed25519 key and picks the
+// matching algorithm (RS256, ES256/ES384/ES512 or EdDSA).
+func NewKey(id string, key interface{}) (*Key, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, signingKey: k, verifyKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, verifyKey: k}, nil
+	case *ecdsa.PrivateKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Method: method, signingKey: k, verifyKey: &k.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Method: method, verifyKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, signingKey: k, verifyKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+}
+
+func ecdsaMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, curve.Params().Name)
+	}
+}
+
+func (k *Key) CanSign() bool {
+	return k.signingKey != nil
+}
+
+func (k *Key) PublicKey() crypto.PublicKey {
+	return k.verifyKey
+}
+
+// KeySet signs with its current key and verifies with any of its keys, so
+// tokens signed by a previous key stay valid until that key is removed.
+type KeySet struct {
+	current *Key
+	keys    map[string]*Key
+	ordered []*Key
+	methods []string
+}
+
+// NewKeySet uses the first key to sign new tokens.
+func NewKeySet(keys ...*Key) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, ErrUnknownKey
+	}
+	if !keys[0].CanSign() {
+		return nil, fmt.Errorf("%w: %s", ErrMissingSigningKey, keys[0].ID)
+	}
+	set := &KeySet{
+		current: keys[0],
+		keys:    make(map[string]*Key, len(keys)),
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicated key id %q", key.ID)
+		}
+		set.keys[key.ID] = key
+		set.ordered = append(set.ordered, key)
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			set.methods = append(set.methods, alg)
+		}
+	}
+	return set, nil
+}
+
+// NewHMACKeySet keeps the shared-secret HS256 behaviour for deployments
+// that have not configured asymmetric keys. Its tokens carry no kid.
+func NewHMACKeySet(secret []byte) *KeySet {
+	key := &Key{Method: jwt.SigningMethodHS256, signingKey: secret, verifyKey: secret}
+	return &KeySet{
+		current: key,
+		keys:    map[string]*Key{"": key},
+		ordered: []*Key{key},
+		methods: []string{jwt.SigningMethodHS256.Alg()},
+	}
+}
+
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.current.Method, claims)
+	if s.current.ID != "" {
+		token.Header["kid"] = s.current.ID
+	}
+	return token.SignedString(s.current.signingKey)
+}
+
+// Keyfunc resolves the verification key from the kid header, to be used
+// with jwt.Parse together with jwt.WithValidMethods(s.Methods()).
+func (s *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if key.Method.Alg() != t.Method.Alg() {
+		return nil, fmt.Errorf("%w: %q is not a %s key", ErrUnknownKey, kid, t.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+func (s *KeySet) Methods() []string {
+	return s.methods
+}
+
+// Keys returns every key of the set, the current one first.
+func (s *KeySet) Keys() []*Key {
+	return s.ordered
+}
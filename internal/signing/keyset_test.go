@@ -0,0 +1,147 @@
+package signing_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SantiagoBedoya/otp-api/internal/signing"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newKey(t *testing.T, id string, key interface{}) *signing.Key {
+	t.Helper()
+	k, err := signing.NewKey(id, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return k
+}
+
+func parse(set *signing.KeySet, token string) (*jwt.Token, error) {
+	return jwt.Parse(token, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+}
+
+func TestKeySetAlgorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		key interface{}
+		alg string
+		kty string
+	}{
+		{rsaKey, "RS256", "RSA"},
+		{ecKey, "ES256", "EC"},
+		{edKey, "EdDSA", "OKP"},
+	}
+	for _, tt := range tests {
+		set, err := signing.NewKeySet(newKey(t, "k1", tt.key))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		signed, err := set.Sign(jwt.MapClaims{"sub": "1"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		token, err := parse(set, signed)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.alg, err)
+		}
+		if token.Header["kid"] != "k1" || token.Method.Alg() != tt.alg {
+			t.Errorf("expected kid k1 and %s, got %v and %s", tt.alg, token.Header["kid"], token.Method.Alg())
+		}
+		jwks := set.JWKS()
+		if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != tt.kty || jwks.Keys[0].Alg != tt.alg {
+			t.Errorf("unexpected jwks %+v", jwks)
+		}
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKeyPair, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	before, _ := signing.NewKeySet(newKey(t, "old", oldKey))
+	issued, err := before.Sign(jwt.MapClaims{"sub": "1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rotated, err := signing.NewKeySet(newKey(t, "new", newKeyPair), newKey(t, "old", &oldKey.PublicKey))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := parse(rotated, issued); err != nil {
+		t.Errorf("tokens from the previous key should still verify: %v", err)
+	}
+	signed, _ := rotated.Sign(jwt.MapClaims{"sub": "1"})
+	token, _ := parse(rotated, signed)
+	if token.Header["kid"] != "new" {
+		t.Errorf("expected new tokens to use kid new, got %v", token.Header["kid"])
+	}
+	if keys := rotated.JWKS().Keys; len(keys) != 2 || keys[0].Kid != "new" || keys[1].Kid != "old" {
+		t.Errorf("unexpected jwks %+v", keys)
+	}
+
+	retired, _ := signing.NewKeySet(newKey(t, "new", newKeyPair))
+	if _, err := parse(retired, issued); !errors.Is(err, signing.ErrUnknownKey) {
+		t.Errorf("expected %v once the key is retired, got %v", signing.ErrUnknownKey, err)
+	}
+}
+
+func TestKeySetRequiresPrivateSigningKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, err := signing.NewKeySet(newKey(t, "k1", &key.PublicKey))
+	if !errors.Is(err, signing.ErrMissingSigningKey) {
+		t.Errorf("expected %v, got %v", signing.ErrMissingSigningKey, err)
+	}
+}
+
+func TestHMACKeySetRejectsAsymmetricTokens(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	set, _ := signing.NewKeySet(newKey(t, "", key))
+	signed, _ := set.Sign(jwt.MapClaims{"sub": "1"})
+
+	hmac := signing.NewHMACKeySet([]byte("secret"))
+	if _, err := parse(hmac, signed); err == nil {
+		t.Error("expected an error verifying an ES256 token with the HMAC key set")
+	}
+	if len(hmac.JWKS().Keys) != 0 {
+		t.Error("the shared secret must not be published")
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	current, _ := rsa.GenerateKey(rand.Reader, 2048)
+	previous, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	der, _ := x509.MarshalPKCS8PrivateKey(current)
+	currentPath := filepath.Join(dir, "current.pem")
+	os.WriteFile(currentPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	der, _ = x509.MarshalPKIXPublicKey(previous)
+	previousPath := filepath.Join(dir, "previous.pem")
+	os.WriteFile(previousPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+
+	set, err := signing.LoadKeySet("2023-06:" + currentPath + ", 2023-01:" + previousPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	keys := set.Keys()
+	if len(keys) != 2 || keys[0].ID != "2023-06" || !keys[0].CanSign() || keys[1].CanSign() {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+	if len(set.Methods()) != 2 {
+		t.Errorf("expected RS256 and EdDSA, got %v", set.Methods())
+	}
+}
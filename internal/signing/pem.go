@@ -0,0 +1,66 @@
+package signing
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadKeySet reads "kid:path" entries separated by commas. The first entry
+// signs new tokens and must hold a private key, the others may be public
+// keys kept to verify tokens issued before a rotation.
+func LoadKeySet(value string) (*KeySet, error) {
+	keys := make([]*Key, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, path, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key entry %q, expected kid:path", entry)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePEM(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys...)
+}
+
+func ParsePEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(id, key)
+}
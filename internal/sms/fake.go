@@ -0,0 +1,44 @@
+package sms
+
+import (
+	"log"
+	"sync"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+)
+
+// FakeSender logs and keeps sent messages instead of delivering them, for
+// development and tests.
+type FakeSender struct {
+	mu       sync.Mutex
+	messages []model.SMSMessage
+}
+
+func NewFakeSender() *FakeSender {
+	return &FakeSender{}
+}
+
+func (s *FakeSender) Send(msg *model.SMSMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log.Printf("SMS to %s: %s", msg.To, msg.Body)
+	s.messages = append(s.messages, *msg)
+	return nil
+}
+
+func (s *FakeSender) Messages() []model.SMSMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]model.SMSMessage(nil), s.messages...)
+}
+
+// Last returns the last message sent, or nil.
+func (s *FakeSender) Last() *model.SMSMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) == 0 {
+		return nil
+	}
+	msg := s.messages[len(s.messages)-1]
+	return &msg
+}
@@ -0,0 +1,24 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SantiagoBedoya/otp-api/internal/config"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+// New returns the sender selected by cfg.Driver.
+func New(cfg config.SMS) (service.SMSSender, error) {
+	switch cfg.Driver {
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return nil, errors.New("SMS_WEBHOOK_URL is required by the webhook driver")
+		}
+		return NewWebhookSender(cfg.WebhookURL, cfg.WebhookToken, cfg.WebhookTimeout), nil
+	case "fake":
+		return NewFakeSender(), nil
+	default:
+		return nil, fmt.Errorf("unknown sms driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,55 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/SantiagoBedoya/otp-api/internal/model"
+	"github.com/SantiagoBedoya/otp-api/internal/service"
+)
+
+type webhookSender struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewWebhookSender POSTs every message as JSON ({"to": ..., "body": ...})
+// to url, so any SMS provider can be plugged in behind a small relay. A
+// non-empty token is sent as a bearer token.
+func NewWebhookSender(url, token string, timeout time.Duration) service.SMSSender {
+	return &webhookSender{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *webhookSender) Send(msg *model.SMSMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("sms webhook answered %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"math/big"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// COSE algorithm identifiers.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgES384 = -35
+	AlgES512 = -36
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms are offered to authenticators in order of preference.
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgES384, AlgES512, AlgRS256}
+
+const (
+	coseKtyOKP   = int64(webauthncose.OctetKey)
+	coseKtyEC2   = int64(webauthncose.EllipticKey)
+	coseKtyRSA   = int64(webauthncose.RSAKey)
+	coseCrvP256  = int64(webauthncose.P256)
+	coseCrvP384  = int64(webauthncose.P384)
+	coseCrvP521  = int64(webauthncose.P521)
+	coseCrvEd255 = int64(webauthncose.Ed25519)
+)
+
+const minRSABits = 2048
+
+// PublicKey is a credential public key decoded from its COSE form.
+type PublicKey struct {
+	Algorithm int
+	key       crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key as stored for a credential. The key
+// is decoded with the CTAP2 CBOR rules of go-webauthn into its COSE types,
+// but checked here: webauthncose.ParsePublicKey ignores decoding errors
+// and hands back keys that cannot be verified with.
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	var header webauthncose.PublicKeyData
+	if err := webauthncbor.Unmarshal(cose, &header); err != nil {
+		return nil, ErrMalformed
+	}
+	alg := int(header.Algorithm)
+	switch alg {
+	case AlgES256, AlgES384, AlgES512:
+		return parseEC2Key(cose, header.KeyType, alg)
+	case AlgEdDSA:
+		// OKPPublicKeyData does not map the crv label, EC2 keys use the
+		// same labels for crv and x.
+		var k webauthncose.EC2PublicKeyData
+		if err := webauthncbor.Unmarshal(cose, &k); err != nil {
+			return nil, ErrMalformed
+		}
+		if header.KeyType != coseKtyOKP || k.Curve != coseCrvEd255 || len(k.XCoord) != ed25519.PublicKeySize {
+			return nil, ErrMalformed
+		}
+		return &PublicKey{Algorithm: AlgEdDSA, key: ed25519.PublicKey(k.XCoord)}, nil
+	case AlgRS256:
+		var k webauthncose.RSAPublicKeyData
+		if err := webauthncbor.Unmarshal(cose, &k); err != nil {
+			return nil, ErrMalformed
+		}
+		if header.KeyType != coseKtyRSA || len(k.Exponent) == 0 || len(k.Exponent) > 4 {
+			return nil, ErrMalformed
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(k.Modulus), E: int(new(big.Int).SetBytes(k.Exponent).Int64())}
+		if key.N.BitLen() < minRSABits || key.E < 3 {
+			return nil, ErrMalformed
+		}
+		return &PublicKey{Algorithm: AlgRS256, key: key}, nil
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+func parseEC2Key(cose []byte, kty int64, alg int) (*PublicKey, error) {
+	var k webauthncose.EC2PublicKeyData
+	if err := webauthncbor.Unmarshal(cose, &k); err != nil {
+		return nil, ErrMalformed
+	}
+	var (
+		curve elliptic.Curve
+		ec    ecdh.Curve
+		crv   int64
+	)
+	switch alg {
+	case AlgES256:
+		curve, ec, crv = elliptic.P256(), ecdh.P256(), coseCrvP256
+	case AlgES384:
+		curve, ec, crv = elliptic.P384(), ecdh.P384(), coseCrvP384
+	case AlgES512:
+		curve, ec, crv = elliptic.P521(), ecdh.P521(), coseCrvP521
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	if kty != coseKtyEC2 || k.Curve != crv || len(k.XCoord) != size || len(k.YCoord) != size {
+		return nil, ErrMalformed
+	}
+	// crypto/ecdh rejects points that are not on the curve.
+	point := append(append([]byte{4}, k.XCoord...), k.YCoord...)
+	if _, err := ec.NewPublicKey(point); err != nil {
+		return nil, ErrMalformed
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(k.XCoord), Y: new(big.Int).SetBytes(k.YCoord)}
+	return &PublicKey{Algorithm: alg, key: key}, nil
+}
+
+// Verify checks an authenticator signature over data.
+func (k *PublicKey) Verify(data, sig []byte) error {
+	ok := false
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest(k.Algorithm, data), sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest(k.Algorithm, data), sig) == nil
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func digest(alg int, data []byte) []byte {
+	switch alg {
+	case AlgES384:
+		sum := sha512.Sum384(data)
+		return sum[:]
+	case AlgES512:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	default:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+}
@@ -0,0 +1,245 @@
+// Package webauthn verifies the registration and authentication ceremonies
+// of the Web Authentication API (https://www.w3.org/TR/webauthn-2/).
+//
+// The CBOR structures sent by authenticators are decoded by
+// github.com/go-webauthn/webauthn, this package adds the relying party
+// checks. Attestation statements are not verified: the relying party asks
+// for "none" and trusts the credential it is handed on first use.
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+const (
+	FlagUserPresent            = 0x01
+	FlagUserVerified           = 0x04
+	FlagBackupEligible         = 0x08
+	FlagBackedUp               = 0x10
+	FlagAttestedCredentialData = 0x40
+	FlagExtensionData          = 0x80
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	challengeSize = 32
+)
+
+var (
+	ErrMalformed            = errors.New("webauthn: malformed data")
+	ErrCeremonyMismatch     = errors.New("webauthn: client data is for another ceremony")
+	ErrChallengeMismatch    = errors.New("webauthn: challenge does not match")
+	ErrOriginMismatch       = errors.New("webauthn: origin is not allowed")
+	ErrRPIDMismatch         = errors.New("webauthn: credential is scoped to another relying party")
+	ErrUserNotPresent       = errors.New("webauthn: user presence is required")
+	ErrUserNotVerified      = errors.New("webauthn: user verification is required")
+	ErrUnsupportedAlgorithm = errors.New("webauthn: unsupported public key algorithm")
+	ErrInvalidSignature     = errors.New("webauthn: invalid signature")
+)
+
+type RelyingParty struct {
+	ID   string
+	Name string
+	// Origins are the exact origins, scheme and port included, allowed to
+	// run the ceremonies.
+	Origins []string
+}
+
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func ParseClientData(raw []byte) (*ClientData, error) {
+	var data ClientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, ErrMalformed
+	}
+	return &data, nil
+}
+
+// ChallengeBytes decodes the challenge echoed back by the client.
+func (c *ClientData) ChallengeBytes() ([]byte, error) {
+	return DecodeBase64URL(c.Challenge)
+}
+
+type AuthenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	// AAGUID, CredentialID and PublicKey are only set by registrations.
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func (d *AuthenticatorData) Has(flag byte) bool {
+	return d.Flags&flag == flag
+}
+
+func ParseAuthenticatorData(raw []byte) (*AuthenticatorData, error) {
+	var parsed protocol.AuthenticatorData
+	if err := parsed.Unmarshal(raw); err != nil {
+		return nil, ErrMalformed
+	}
+	data := &AuthenticatorData{
+		RPIDHash:  parsed.RPIDHash,
+		Flags:     byte(parsed.Flags),
+		SignCount: parsed.Counter,
+	}
+	if data.Has(FlagAttestedCredentialData) {
+		if len(parsed.AttData.CredentialID) == 0 {
+			return nil, ErrMalformed
+		}
+		data.AAGUID = parsed.AttData.AAGUID
+		data.CredentialID = parsed.AttData.CredentialID
+		data.PublicKey = parsed.AttData.CredentialPublicKey
+	}
+	return data, nil
+}
+
+// Credential is a newly registered public key credential.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+	Flags     byte
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create
+// for challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte, requireUV bool) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+	var obj protocol.AttestationObject
+	if err := webauthncbor.Unmarshal(attestationObject, &obj); err != nil {
+		return nil, ErrMalformed
+	}
+	if obj.Format == "" || obj.RawAuthData == nil {
+		return nil, ErrMalformed
+	}
+	data, err := ParseAuthenticatorData(obj.RawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(data, requireUV); err != nil {
+		return nil, err
+	}
+	if !data.Has(FlagAttestedCredentialData) {
+		return nil, ErrMalformed
+	}
+	if _, err := ParsePublicKey(data.PublicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        append([]byte(nil), data.CredentialID...),
+		PublicKey: append([]byte(nil), data.PublicKey...),
+		SignCount: data.SignCount,
+		AAGUID:    append([]byte(nil), data.AAGUID...),
+		Flags:     data.Flags,
+	}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get for
+// challenge against the stored COSE publicKey of the credential.
+func (rp *RelyingParty) VerifyAssertion(challenge, publicKey, clientDataJSON, authenticatorData, signature []byte, requireUV bool) (*AuthenticatorData, error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyGet, challenge); err != nil {
+		return nil, err
+	}
+	data, err := ParseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(data, requireUV); err != nil {
+		return nil, err
+	}
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), hash[:]...)
+	if err := key.Verify(signed, signature); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	data, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if data.Type != ceremony {
+		return ErrCeremonyMismatch
+	}
+	got, err := data.ChallengeBytes()
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if data.CrossOrigin || !rp.allowedOrigin(data.Origin) {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(data *AuthenticatorData, requireUV bool) error {
+	hash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(data.RPIDHash, hash[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+	if !data.Has(FlagUserPresent) {
+		return ErrUserNotPresent
+	}
+	if requireUV && !data.Has(FlagUserVerified) {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+func (rp *RelyingParty) allowedOrigin(origin string) bool {
+	for _, o := range rp.Origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// EncodeBase64URL encodes binary values the way the WebAuthn JSON
+// serialization does, unpadded base64url.
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeBase64URL accepts padded and unpadded base64url.
+func DecodeBase64URL(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return b, nil
+}
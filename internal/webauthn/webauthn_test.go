@@ -0,0 +1,174 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SantiagoBedoya/otp-api/internal/webauthn"
+	"github.com/SantiagoBedoya/otp-api/internal/webauthn/webauthntest"
+)
+
+const testOrigin = "https://example.com"
+
+var testRP = &webauthn.RelyingParty{ID: "example.com", Name: "Example", Origins: []string{testOrigin}}
+
+func newChallenge(t *testing.T) []byte {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("example.com", testOrigin)
+
+	challenge := newChallenge(t)
+	clientData, attestation := authenticator.Create(challenge)
+	cred, err := testRP.VerifyRegistration(challenge, clientData, attestation, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(cred.ID) != string(authenticator.CredentialID) {
+		t.Errorf("expected credential id %x, got %x", authenticator.CredentialID, cred.ID)
+	}
+
+	challenge = newChallenge(t)
+	clientData, authData, sig := authenticator.Get(challenge)
+	data, err := testRP.VerifyAssertion(challenge, cred.PublicKey, clientData, authData, sig, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data.SignCount != 1 {
+		t.Errorf("expected sign count 1, got %d", data.SignCount)
+	}
+
+	sig[len(sig)-1] ^= 0xff
+	if _, err := testRP.VerifyAssertion(challenge, cred.PublicKey, clientData, authData, sig, true); !errors.Is(err, webauthn.ErrInvalidSignature) {
+		t.Errorf("expected error: %v, got %v", webauthn.ErrInvalidSignature, err)
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name          string
+		authenticator *webauthntest.Authenticator
+		challenge     []byte
+		requireUV     bool
+		err           error
+	}{
+		{
+			name:          "another origin",
+			authenticator: webauthntest.NewAuthenticator("example.com", "https://evil.example.net"),
+			err:           webauthn.ErrOriginMismatch,
+		},
+		{
+			name:          "another relying party",
+			authenticator: webauthntest.NewAuthenticator("evil.example.net", testOrigin),
+			err:           webauthn.ErrRPIDMismatch,
+		},
+		{
+			name:          "another challenge",
+			authenticator: webauthntest.NewAuthenticator("example.com", testOrigin),
+			challenge:     []byte("another challenge"),
+			err:           webauthn.ErrChallengeMismatch,
+		},
+		{
+			name: "unverified user",
+			authenticator: func() *webauthntest.Authenticator {
+				a := webauthntest.NewAuthenticator("example.com", testOrigin)
+				a.Flags = webauthntest.FlagUserPresent
+				return a
+			}(),
+			requireUV: true,
+			err:       webauthn.ErrUserNotVerified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge := newChallenge(t)
+			clientData, attestation := tt.authenticator.Create(challenge)
+			if tt.challenge != nil {
+				challenge = tt.challenge
+			}
+			_, err := testRP.VerifyRegistration(challenge, clientData, attestation, tt.requireUV)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected error: %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejectsRegistrationResponse(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("example.com", testOrigin)
+	challenge := newChallenge(t)
+	clientData, _ := authenticator.Create(challenge)
+	_, authData, sig := authenticator.Get(challenge)
+	_, err := testRP.VerifyAssertion(challenge, authenticator.PublicKey(), clientData, authData, sig, false)
+	if !errors.Is(err, webauthn.ErrCeremonyMismatch) {
+		t.Errorf("expected error: %v, got %v", webauthn.ErrCeremonyMismatch, err)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("example.com", testOrigin)
+	challenge := newChallenge(t)
+	clientData, attestation := authenticator.Create(challenge)
+	for i := range attestation {
+		if _, err := testRP.VerifyRegistration(challenge, clientData, attestation[:i], false); err == nil {
+			t.Fatalf("expected an error for an attestation truncated to %d bytes", i)
+		}
+	}
+	if _, err := webauthn.ParsePublicKey(webauthntest.Encode(map[any]any{1: 2, 3: -7, -1: 1, -2: make([]byte, 32), -3: make([]byte, 32)})); !errors.Is(err, webauthn.ErrMalformed) {
+		t.Errorf("expected a point off the curve to be rejected, got %v", err)
+	}
+	if _, err := webauthn.ParsePublicKey(webauthntest.Encode(map[any]any{1: 2, 3: -65535})); !errors.Is(err, webauthn.ErrUnsupportedAlgorithm) {
+		t.Errorf("expected error: %v, got %v", webauthn.ErrUnsupportedAlgorithm, err)
+	}
+}
+
+func FuzzVerifyRegistration(f *testing.F) {
+	authenticator := webauthntest.NewAuthenticator("example.com", testOrigin)
+	challenge := []byte("fuzz challenge")
+	clientData, attestation := authenticator.Create(challenge)
+	f.Add(attestation)
+	f.Fuzz(func(t *testing.T, attestation []byte) {
+		cred, err := testRP.VerifyRegistration(challenge, clientData, attestation, false)
+		if err != nil {
+			return
+		}
+		if _, err := webauthn.ParsePublicKey(cred.PublicKey); err != nil {
+			t.Errorf("a registered credential should have a valid public key: %v", err)
+		}
+	})
+}
+
+func FuzzParseAuthenticatorData(f *testing.F) {
+	authenticator := webauthntest.NewAuthenticator("example.com", testOrigin)
+	_, authData, _ := authenticator.Get([]byte("fuzz challenge"))
+	f.Add(authData)
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		data, err := webauthn.ParseAuthenticatorData(raw)
+		if err != nil {
+			return
+		}
+		if data.Has(webauthn.FlagAttestedCredentialData) {
+			webauthn.ParsePublicKey(data.PublicKey)
+		}
+	})
+}
+
+func FuzzParsePublicKey(f *testing.F) {
+	f.Add(webauthntest.NewAuthenticator("example.com", testOrigin).PublicKey())
+	f.Add(webauthntest.Encode(map[any]any{1: 1, 3: -8, -1: 6, -2: make([]byte, 32)}))
+	f.Add(webauthntest.Encode(map[any]any{1: 3, 3: -257, -1: make([]byte, 256), -2: []byte{1, 0, 1}}))
+	f.Fuzz(func(t *testing.T, cose []byte) {
+		key, err := webauthn.ParsePublicKey(cose)
+		if err != nil {
+			return
+		}
+		if key.Verify([]byte("data"), []byte("signature")) == nil {
+			t.Error("a made up signature should not verify")
+		}
+	})
+}
@@ -0,0 +1,108 @@
+// Package webauthntest provides a software authenticator so the WebAuthn
+// ceremonies can be tested without hardware.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+)
+
+const (
+	FlagUserPresent            = 0x01
+	FlagUserVerified           = 0x04
+	FlagAttestedCredentialData = 0x40
+)
+
+// Authenticator holds a single ES256 credential.
+type Authenticator struct {
+	RPID   string
+	Origin string
+	// Flags are set on every response, user presence and verification by
+	// default.
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	key          *ecdsa.PrivateKey
+}
+
+func NewAuthenticator(rpID, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return &Authenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		Flags:        FlagUserPresent | FlagUserVerified,
+		CredentialID: id,
+		key:          key,
+	}
+}
+
+// Create answers navigator.credentials.create with a "none" attestation.
+func (a *Authenticator) Create(challenge []byte) (clientDataJSON, attestationObject []byte) {
+	clientDataJSON = a.clientData("webauthn.create", challenge)
+	authData := a.authenticatorData(a.Flags | FlagAttestedCredentialData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, a.PublicKey()...)
+	attestationObject = Encode(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": authData,
+	})
+	return clientDataJSON, attestationObject
+}
+
+// Get answers navigator.credentials.get, bumping the signature counter.
+func (a *Authenticator) Get(challenge []byte) (clientDataJSON, authenticatorData, signature []byte) {
+	a.SignCount++
+	clientDataJSON = a.clientData("webauthn.get", challenge)
+	authenticatorData = a.authenticatorData(a.Flags)
+	hash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authenticatorData...), hash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return clientDataJSON, authenticatorData, signature
+}
+
+// PublicKey returns the credential public key as a COSE_Key.
+func (a *Authenticator) PublicKey() []byte {
+	return Encode(map[any]any{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, err := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.Origin,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func (a *Authenticator) authenticatorData(flags byte) []byte {
+	hash := sha256.Sum256([]byte(a.RPID))
+	data := append(hash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.SignCount)
+}
@@ -0,0 +1,12 @@
+package webauthntest
+
+import "github.com/go-webauthn/webauthn/protocol/webauthncbor"
+
+// Encode serializes v as CTAP2 canonical CBOR, the way authenticators do.
+func Encode(v any) []byte {
+	b, err := webauthncbor.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    revoked_at DATETIME DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX idx_refresh_tokens_family (family_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
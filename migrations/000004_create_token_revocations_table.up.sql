@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(64) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (jti),
+    INDEX idx_revoked_tokens_expires_at (expires_at)
+);
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id INT NOT NULL,
+    revoked_before DATETIME NOT NULL,
+    PRIMARY KEY (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX idx_recovery_codes_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
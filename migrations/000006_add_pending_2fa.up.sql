@@ -0,0 +1 @@
+ALTER TABLE users ADD pending_secret_2fa VARCHAR(255) DEFAULT NULL;
@@ -0,0 +1 @@
+ALTER TABLE users ADD last_otp_counter BIGINT NOT NULL DEFAULT 0;
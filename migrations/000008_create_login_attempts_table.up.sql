@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    attempt_key VARCHAR(255) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at DATETIME DEFAULT NULL,
+    locked_until DATETIME DEFAULT NULL,
+    PRIMARY KEY (attempt_key)
+);
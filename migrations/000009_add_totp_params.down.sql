@@ -0,0 +1,8 @@
+ALTER TABLE users DROP COLUMN pending_otp_period;
+ALTER TABLE users DROP COLUMN pending_otp_digits;
+ALTER TABLE users DROP COLUMN pending_otp_algorithm;
+ALTER TABLE users DROP COLUMN otp_period;
+ALTER TABLE users DROP COLUMN otp_digits;
+ALTER TABLE users DROP COLUMN otp_algorithm;
+UPDATE users SET last_otp_at = last_otp_at DIV 30;
+ALTER TABLE users CHANGE last_otp_at last_otp_counter BIGINT NOT NULL DEFAULT 0;
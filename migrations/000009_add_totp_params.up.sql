@@ -0,0 +1,8 @@
+ALTER TABLE users CHANGE last_otp_counter last_otp_at BIGINT NOT NULL DEFAULT 0;
+UPDATE users SET last_otp_at = last_otp_at * 30;
+ALTER TABLE users ADD otp_algorithm VARCHAR(16) NOT NULL DEFAULT 'SHA1';
+ALTER TABLE users ADD otp_digits TINYINT NOT NULL DEFAULT 6;
+ALTER TABLE users ADD otp_period INT NOT NULL DEFAULT 30;
+ALTER TABLE users ADD pending_otp_algorithm VARCHAR(16) NOT NULL DEFAULT 'SHA1';
+ALTER TABLE users ADD pending_otp_digits TINYINT NOT NULL DEFAULT 6;
+ALTER TABLE users ADD pending_otp_period INT NOT NULL DEFAULT 30;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id VARCHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    secret_hash CHAR(64) DEFAULT NULL,
+    redirect_uris TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    id INT NOT NULL AUTO_INCREMENT,
+    code_hash CHAR(64) NOT NULL UNIQUE,
+    client_id VARCHAR(64) NOT NULL,
+    user_id INT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scope VARCHAR(255) NOT NULL,
+    nonce VARCHAR(255) NOT NULL DEFAULT '',
+    code_challenge VARCHAR(128) NOT NULL,
+    family_id VARCHAR(64) DEFAULT NULL,
+    auth_time DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    FOREIGN KEY (client_id) REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE oauth_authorization_codes DROP COLUMN amr;
+ALTER TABLE refresh_tokens DROP COLUMN amr;
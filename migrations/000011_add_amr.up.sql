@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens ADD amr VARCHAR(64) NOT NULL DEFAULT '' AFTER token_hash;
+ALTER TABLE oauth_authorization_codes ADD amr VARCHAR(64) NOT NULL DEFAULT '' AFTER code_challenge;
@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens ADD auth_time DATETIME DEFAULT NULL AFTER amr;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS email_otp_codes;
+ALTER TABLE users DROP COLUMN mfa_method;
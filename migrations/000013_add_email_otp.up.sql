@@ -0,0 +1,14 @@
+ALTER TABLE users ADD mfa_method VARCHAR(16) NOT NULL DEFAULT 'totp' AFTER secret_2fa;
+
+CREATE TABLE IF NOT EXISTS email_otp_codes (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    purpose VARCHAR(16) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX idx_email_otp_codes_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS sms_otp_codes;
+ALTER TABLE users DROP COLUMN phone_verified, DROP COLUMN phone;
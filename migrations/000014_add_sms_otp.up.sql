@@ -0,0 +1,15 @@
+ALTER TABLE users ADD phone VARCHAR(16) DEFAULT NULL AFTER email, ADD phone_verified TINYINT(1) NOT NULL DEFAULT 0 AFTER phone;
+
+CREATE TABLE IF NOT EXISTS sms_otp_codes (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    phone VARCHAR(16) NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    purpose VARCHAR(16) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX idx_sms_otp_codes_user (user_id, created_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
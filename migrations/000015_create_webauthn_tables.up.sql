@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    credential_id VARBINARY(1023) NOT NULL UNIQUE,
+    public_key BLOB NOT NULL,
+    sign_count INT UNSIGNED NOT NULL DEFAULT 0,
+    transports VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME DEFAULT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_webauthn_credentials_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT DEFAULT NULL,
+    challenge_hash CHAR(64) NOT NULL UNIQUE,
+    ceremony VARCHAR(16) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN hotp_counter;
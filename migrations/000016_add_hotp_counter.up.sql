@@ -0,0 +1 @@
+ALTER TABLE users ADD hotp_counter BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER last_otp_at;
@@ -0,0 +1,24 @@
+ALTER TABLE users
+    ADD secret_2fa VARCHAR(255) DEFAULT NULL,
+    ADD pending_secret_2fa VARCHAR(255) DEFAULT NULL,
+    ADD last_otp_at BIGINT NOT NULL DEFAULT 0,
+    ADD hotp_counter BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    ADD otp_algorithm VARCHAR(16) NOT NULL DEFAULT 'SHA1',
+    ADD otp_digits TINYINT NOT NULL DEFAULT 6,
+    ADD otp_period INT NOT NULL DEFAULT 30,
+    ADD pending_otp_algorithm VARCHAR(16) NOT NULL DEFAULT 'SHA1',
+    ADD pending_otp_digits TINYINT NOT NULL DEFAULT 6,
+    ADD pending_otp_period INT NOT NULL DEFAULT 30;
+
+-- Only the oldest active factor of each user fits back into users.
+UPDATE users u JOIN mfa_factors f ON f.id = (
+    SELECT MIN(id) FROM mfa_factors WHERE user_id = u.id AND active = 1
+)
+SET u.secret_2fa = f.secret, u.otp_algorithm = f.otp_algorithm, u.otp_digits = f.otp_digits,
+    u.otp_period = f.otp_period, u.hotp_counter = f.counter, u.last_otp_at = f.last_otp_at;
+
+UPDATE users u JOIN mfa_factors f ON f.user_id = u.id AND f.active = 0
+SET u.pending_secret_2fa = f.secret, u.pending_otp_algorithm = f.otp_algorithm,
+    u.pending_otp_digits = f.otp_digits, u.pending_otp_period = f.otp_period;
+
+DROP TABLE IF EXISTS mfa_factors;
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS mfa_factors (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    otp_algorithm VARCHAR(16) NOT NULL DEFAULT 'SHA1',
+    otp_digits TINYINT NOT NULL DEFAULT 6,
+    otp_period INT NOT NULL DEFAULT 30,
+    counter BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    last_otp_at BIGINT NOT NULL DEFAULT 0,
+    active TINYINT(1) NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME DEFAULT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_mfa_factors_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO mfa_factors (user_id, type, name, secret, otp_algorithm, otp_digits, otp_period, counter, last_otp_at, active)
+SELECT id, IF(mfa_method = 'hotp', 'hotp', 'totp'), IF(mfa_method = 'hotp', 'Key fob', 'Authenticator app'),
+    secret_2fa, otp_algorithm, otp_digits, otp_period, hotp_counter, last_otp_at, 1
+FROM users WHERE secret_2fa IS NOT NULL;
+
+INSERT INTO mfa_factors (user_id, type, name, secret, otp_algorithm, otp_digits, otp_period, last_otp_at, active)
+SELECT id, 'totp', 'Authenticator app', pending_secret_2fa, pending_otp_algorithm, pending_otp_digits, pending_otp_period, last_otp_at, 0
+FROM users WHERE pending_secret_2fa IS NOT NULL;
+
+ALTER TABLE users
+    DROP COLUMN secret_2fa,
+    DROP COLUMN pending_secret_2fa,
+    DROP COLUMN last_otp_at,
+    DROP COLUMN hotp_counter,
+    DROP COLUMN otp_algorithm,
+    DROP COLUMN otp_digits,
+    DROP COLUMN otp_period,
+    DROP COLUMN pending_otp_algorithm,
+    DROP COLUMN pending_otp_digits,
+    DROP COLUMN pending_otp_period;
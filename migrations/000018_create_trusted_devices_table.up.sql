@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS trusted_devices (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    last_used_at DATETIME DEFAULT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_trusted_devices_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD email_verified_at DATETIME DEFAULT NULL AFTER email, ADD email_verification_sent_at DATETIME DEFAULT NULL AFTER email_verified_at;
+
+-- Accounts created before addresses were verified keep working.
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens DROP FOREIGN KEY fk_refresh_tokens_client, DROP COLUMN scope, DROP COLUMN client_id;
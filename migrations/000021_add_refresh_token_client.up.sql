@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens ADD client_id VARCHAR(64) DEFAULT NULL AFTER family_id, ADD scope VARCHAR(255) NOT NULL DEFAULT '' AFTER client_id, ADD CONSTRAINT fk_refresh_tokens_client FOREIGN KEY (client_id) REFERENCES oauth_clients(id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE webauthn_credentials ADD name VARCHAR(64) NOT NULL DEFAULT 'Security key' AFTER user_id;